@@ -8,8 +8,10 @@ require (
 	github.com/go-git/go-git/v5 v5.16.5
 	github.com/jmoiron/sqlx v1.4.0
 	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/ulikunitz/xz v0.5.15
 	github.com/yuin/goldmark v1.7.16
 	golang.org/x/crypto v0.48.0
+	golang.org/x/mod v0.40.0
 	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.46.1
 )
@@ -0,0 +1,246 @@
+// Package archive keeps generated repository archives on disk so that a
+// download for a given commit is built once, served byte-for-byte identical
+// afterwards and published with a SHA-256 checksum.
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+)
+
+// CacheDir returns the archive cache directory inside a data directory.
+func CacheDir(dataPath string) string {
+	return filepath.Join(dataPath, "cache", "archives")
+}
+
+// Entry is a cached archive and its checksum.
+type Entry struct {
+	Path   string // archive file on disk
+	Name   string // download file name, e.g. "repo-v1.0.tar.gz"
+	SHA256 string // hex digest of the archive
+}
+
+// Checksum returns the entry's checksum line in sha256sum format.
+func (e *Entry) Checksum() string {
+	return e.SHA256 + "  " + e.Name + "\n"
+}
+
+// Cache stores archives under {dir}/{repo}/{commit}-{key}.{format}, each
+// with a ".sha256" sidecar. The total size is kept under maxBytes by
+// removing the least recently served archives.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	building map[string]chan struct{}
+}
+
+// New creates a cache rooted at dir. A maxBytes of zero disables caching:
+// Enabled reports false, but the invalidation methods still clean up.
+func New(dir string, maxBytes int64) *Cache {
+	return &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		building: make(map[string]chan struct{}),
+	}
+}
+
+// Enabled reports whether archives should be served through the cache.
+func (c *Cache) Enabled() bool {
+	return c.maxBytes > 0
+}
+
+// Get returns the cached archive of a in the given format, building it
+// first if needed. name is the download name without extension; it is also
+// the top-level directory inside the archive. Concurrent requests for the
+// same archive wait for a single build.
+func (c *Cache) Get(repo string, a *gitpkg.Archive, format, name string) (*Entry, error) {
+	path := c.entryPath(repo, a, format, name)
+	fileName := name + "." + format
+
+	for {
+		c.mu.Lock()
+		if e, err := readEntry(path, fileName); err == nil {
+			c.mu.Unlock()
+			// Bump the mtime so eviction keeps recently served archives.
+			now := time.Now()
+			os.Chtimes(path, now, now) //nolint:errcheck
+			return e, nil
+		}
+		if done, ok := c.building[path]; ok {
+			c.mu.Unlock()
+			<-done
+			continue
+		}
+		done := make(chan struct{})
+		c.building[path] = done
+		c.mu.Unlock()
+
+		e, err := build(path, fileName, a, format, name+"/")
+
+		c.mu.Lock()
+		delete(c.building, path)
+		close(done)
+		c.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+		c.evict()
+		return e, nil
+	}
+}
+
+// entryPath returns where an archive is stored. The commit leads the file
+// name so that all archives of a commit can be dropped together; the rest
+// of the key (subdirectory and top-level name) is hashed.
+func (c *Cache) entryPath(repo string, a *gitpkg.Archive, format, name string) string {
+	sum := sha256.Sum256([]byte(a.Path + "\x00" + name))
+	key := hex.EncodeToString(sum[:6])
+	return filepath.Join(c.dir, repo, a.Commit.String()+"-"+key+"."+format)
+}
+
+func readEntry(path, fileName string) (*Entry, error) {
+	data, err := os.ReadFile(path + ".sha256")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	sum, _, _ := strings.Cut(string(data), " ")
+	return &Entry{Path: path, Name: fileName, SHA256: sum}, nil
+}
+
+// build writes the archive to a temporary file, hashing it on the way, and
+// renames it into place. The sidecar is written last; an archive without
+// one is treated as missing.
+func build(path, fileName string, a *gitpkg.Archive, format, prefix string) (*Entry, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	h := sha256.New()
+	if err := a.Write(io.MultiWriter(tmp, h), format, prefix); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("write archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	e := &Entry{Path: path, Name: fileName, SHA256: hex.EncodeToString(h.Sum(nil))}
+	if err := os.WriteFile(path+".sha256", []byte(e.Checksum()), 0o644); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// evict removes the least recently served archives until the cache fits
+// in maxBytes.
+func (c *Cache) evict() {
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []file
+	var total int64
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error { //nolint:errcheck
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".sha256") || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if total <= c.maxBytes {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		os.Remove(f.path + ".sha256") //nolint:errcheck
+		os.Remove(f.path)             //nolint:errcheck
+		total -= f.size
+		slog.Debug("archive cache: evicted", "path", f.path, "size", f.size)
+	}
+}
+
+// InvalidateCommits removes every cached archive of the given commits,
+// e.g. the old targets of refs that just moved.
+func (c *Cache) InvalidateCommits(repo string, commits []string) error {
+	dir := filepath.Join(c.dir, repo)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range entries {
+		for _, commit := range commits {
+			if strings.HasPrefix(e.Name(), commit+"-") {
+				os.Remove(filepath.Join(dir, e.Name())) //nolint:errcheck
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveRepo drops all cached archives of a repository.
+func (c *Cache) RemoveRepo(repo string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return os.RemoveAll(filepath.Join(c.dir, repo))
+}
+
+// RenameRepo drops the cached archives of a renamed repository. They use
+// the old name as their top-level directory, so they can't be moved over;
+// anything left under the new name is stale too.
+func (c *Cache) RenameRepo(oldName, newName string) error {
+	if err := c.RemoveRepo(oldName); err != nil {
+		return err
+	}
+	return c.RemoveRepo(newName)
+}
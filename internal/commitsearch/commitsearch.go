@@ -0,0 +1,363 @@
+// Package commitsearch indexes the commits reachable from each
+// repository's branches and tags in the database, for searching by
+// message, author, committer, date and path without walking the history.
+// Messages and names go into a full-text (FTS5) table.
+//
+// The index remembers the ref tips it was last brought up to date with;
+// an update only reads the commits added since, and drops the commits
+// that rewound or deleted refs left unreachable. The post-receive hook
+// updates the index after every push, and a search updates it first if it
+// has fallen behind.
+package commitsearch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+)
+
+// batchSize is how many commits are inserted per transaction, so that a
+// large first index doesn't hold the database's write lock for long.
+const batchSize = 1000
+
+// Index reads and updates the commit index.
+type Index struct {
+	db *sqlx.DB
+	mu sync.Mutex // serializes updates from this process
+}
+
+// New creates an index backed by db.
+func New(db *sqlx.DB) *Index {
+	return &Index{db: db}
+}
+
+// Update indexes the commits that a repository's refs gained since the
+// last update.
+func (x *Index) Update(ctx context.Context, repoName, repoPath string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var repoID int64
+	if err := x.db.Get(&repoID, "SELECT id FROM repositories WHERE name = ?", repoName); err != nil {
+		return fmt.Errorf("find repository %s: %w", repoName, err)
+	}
+
+	tips, err := gitpkg.RefTips(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	var indexed []string
+	if err := x.db.Select(&indexed, "SELECT hash FROM commit_index_tips WHERE repo_id = ?", repoID); err != nil {
+		return fmt.Errorf("load indexed tips: %w", err)
+	}
+	slices.Sort(tips)
+	slices.Sort(indexed)
+	if slices.Equal(tips, indexed) {
+		return nil
+	}
+
+	// Commits that refs rewound or deleted since left behind are dropped,
+	// with the new tips, once the commits the refs gained are in.
+	exclude, gone, err := x.unreachable(ctx, repoID, repoPath, indexed, tips)
+	if err != nil {
+		return err
+	}
+
+	if len(tips) > 0 {
+		var batch []*gitpkg.CommitRecord
+		err := gitpkg.WalkCommits(ctx, repoPath, tips, exclude, func(c *gitpkg.CommitRecord) error {
+			if batch = append(batch, c); len(batch) < batchSize {
+				return nil
+			}
+			err := x.insert(repoID, batch)
+			batch = batch[:0]
+			return err
+		})
+		if err == nil {
+			err = x.insert(repoID, batch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := x.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("save indexed tips: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	for _, hash := range gone {
+		if _, err := tx.Exec("DELETE FROM commit_index WHERE repo_id = ? AND hash = ?", repoID, hash); err != nil {
+			return fmt.Errorf("drop unreachable commits: %w", err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM commit_index_tips WHERE repo_id = ?", repoID); err != nil {
+		return fmt.Errorf("save indexed tips: %w", err)
+	}
+	for _, tip := range tips {
+		if _, err := tx.Exec("INSERT INTO commit_index_tips (repo_id, hash) VALUES (?, ?)", repoID, tip); err != nil {
+			return fmt.Errorf("save indexed tips: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save indexed tips: %w", err)
+	}
+	return nil
+}
+
+// unreachable compares the tips the index was last brought up to date
+// with to the current ones. It returns those of the indexed tips that
+// still exist, which the walk for new commits stops at, and the indexed
+// commits no longer reachable from any ref. When an indexed tip no longer
+// exists, the commits only it reached can't be listed from it, so every
+// indexed commit is checked instead.
+func (x *Index) unreachable(ctx context.Context, repoID int64, repoPath string, indexed, tips []string) ([]string, []string, error) {
+	if len(indexed) == 0 {
+		return nil, nil, nil
+	}
+	existing, err := gitpkg.Existing(ctx, repoPath, indexed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(existing) == len(indexed) {
+		gone, err := gitpkg.Unreachable(ctx, repoPath, indexed, tips)
+		return existing, gone, err
+	}
+
+	reachable, err := gitpkg.Reachable(ctx, repoPath, tips)
+	if err != nil {
+		return nil, nil, err
+	}
+	var hashes []string
+	if err := x.db.Select(&hashes, "SELECT hash FROM commit_index WHERE repo_id = ?", repoID); err != nil {
+		return nil, nil, fmt.Errorf("load indexed commits: %w", err)
+	}
+	var gone []string
+	for _, h := range hashes {
+		if !reachable[h] {
+			gone = append(gone, h)
+		}
+	}
+	return existing, gone, nil
+}
+
+// insert adds commits to the index. Commits already there are skipped,
+// so overlapping updates are harmless.
+func (x *Index) insert(repoID int64, commits []*gitpkg.CommitRecord) error {
+	if len(commits) == 0 {
+		return nil
+	}
+	tx, err := x.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("index commits: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	stmt, err := tx.Preparex(`
+		INSERT OR IGNORE INTO commit_index (repo_id, hash, author, author_email, authored_at, committer, committer_email, committed_at, parents, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("index commits: %w", err)
+	}
+	defer stmt.Close()
+	for _, c := range commits {
+		_, err := stmt.Exec(repoID, c.Hash, c.Author, c.AuthorEmail, c.Date.Unix(),
+			c.Committer, c.CommitterEmail, c.CommitDate.Unix(), strings.Join(c.Parents, " "), c.Message)
+		if err != nil {
+			return fmt.Errorf("index commit %s: %w", c.Hash, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("index commits: %w", err)
+	}
+	return nil
+}
+
+// Query selects commits. Text fields match whole words, or words starting
+// with the given ones, in any order; every field given must match.
+type Query struct {
+	Text      string    // words in the message
+	Author    string    // words in the author's name or email
+	Committer string    // words in the committer's name or email
+	Since     time.Time // committed at or after, if set
+	Until     time.Time // committed at or before, if set
+	Path      string    // changed this file or directory
+}
+
+// IsZero reports whether the query has no criteria.
+func (q Query) IsZero() bool {
+	return q == Query{}
+}
+
+type row struct {
+	Hash        string `db:"hash"`
+	Author      string `db:"author"`
+	AuthorEmail string `db:"author_email"`
+	AuthoredAt  int64  `db:"authored_at"`
+	Parents     string `db:"parents"`
+	Message     string `db:"message"`
+}
+
+// Search returns a page of the commits of a repository matching q, newest
+// first by commit date. Pages are addressed by commit: page.After is the
+// last commit of the page before, and page.Before the first of the page
+// after.
+func (x *Index) Search(ctx context.Context, repoName, repoPath string, q Query, page gitpkg.Page) ([]gitpkg.CommitInfo, gitpkg.PageInfo, error) {
+	match, ok := matchExpr(q)
+	if !ok {
+		return nil, gitpkg.PageInfo{}, nil
+	}
+	if err := x.Update(ctx, repoName, repoPath); err != nil {
+		return nil, gitpkg.PageInfo{}, err
+	}
+
+	query := `SELECT c.hash, c.author, c.author_email, c.authored_at, c.parents, c.message FROM commit_index c`
+	var where []string
+	var args []any
+	if match != "" {
+		// As a subquery the match runs once, rather than once per commit
+		// when the planner walks commit_index in date order.
+		where = append(where, "c.id IN (SELECT rowid FROM commit_index_fts WHERE commit_index_fts MATCH ?)")
+		args = append(args, match)
+	}
+	where = append(where, "c.repo_id = (SELECT id FROM repositories WHERE name = ?)")
+	args = append(args, repoName)
+	// Going back, the commits just newer than page.Before are read oldest
+	// first and put back in order at the end.
+	back := page.Before != ""
+	pos := page.After
+	if back {
+		pos = page.Before
+	}
+	if pos != "" {
+		var at struct {
+			ID          int64 `db:"id"`
+			CommittedAt int64 `db:"committed_at"`
+		}
+		err := x.db.Get(&at, `
+			SELECT id, committed_at FROM commit_index
+			WHERE repo_id = (SELECT id FROM repositories WHERE name = ?) AND hash = ?`,
+			repoName, pos,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, gitpkg.PageInfo{}, fmt.Errorf("%w: %s is not a commit of %s", gitpkg.ErrUnknownRevision, pos, repoName)
+		}
+		if err != nil {
+			return nil, gitpkg.PageInfo{}, fmt.Errorf("search commits: %w", err)
+		}
+		if back {
+			where = append(where, "(c.committed_at > ? OR (c.committed_at = ? AND c.id > ?))")
+		} else {
+			where = append(where, "(c.committed_at < ? OR (c.committed_at = ? AND c.id < ?))")
+		}
+		args = append(args, at.CommittedAt, at.CommittedAt, at.ID)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "c.committed_at >= ?")
+		args = append(args, q.Since.Unix())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "c.committed_at <= ?")
+		args = append(args, q.Until.Unix())
+	}
+	query += " WHERE " + strings.Join(where, " AND ")
+	if back {
+		query += " ORDER BY c.committed_at ASC, c.id ASC"
+	} else {
+		query += " ORDER BY c.committed_at DESC, c.id DESC"
+	}
+
+	// A path narrows the commits to those git finds changing it, which
+	// is filtered as the rows are read.
+	var inPath map[string]bool
+	if q.Path != "" {
+		var err error
+		if inPath, err = gitpkg.PathCommits(ctx, repoPath, q.Path); err != nil {
+			return nil, gitpkg.PageInfo{}, err
+		}
+	} else {
+		query += " LIMIT ?"
+		args = append(args, page.Size+1)
+	}
+
+	rows, err := x.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, gitpkg.PageInfo{}, fmt.Errorf("search commits: %w", err)
+	}
+	defer rows.Close()
+
+	var commits []gitpkg.CommitInfo
+	for len(commits) <= page.Size && rows.Next() {
+		var r row
+		if err := rows.StructScan(&r); err != nil {
+			return nil, gitpkg.PageInfo{}, fmt.Errorf("search commits: %w", err)
+		}
+		if inPath != nil && !inPath[r.Hash] {
+			continue
+		}
+		commits = append(commits, gitpkg.CommitInfo{
+			Hash:        r.Hash,
+			ShortHash:   r.Hash[:7],
+			Author:      r.Author,
+			AuthorEmail: r.AuthorEmail,
+			Date:        time.Unix(r.AuthoredAt, 0),
+			Parents:     strings.Fields(r.Parents),
+			Message:     r.Message,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, gitpkg.PageInfo{}, fmt.Errorf("search commits: %w", err)
+	}
+
+	// One extra commit was read to see if there are more.
+	more := len(commits) > page.Size
+	if more {
+		commits = commits[:page.Size]
+	}
+	info := gitpkg.PageInfo{Newer: page.After != ""}
+	if back {
+		slices.Reverse(commits)
+		info.Newer = more
+		more = true // page.Before at least
+	}
+	if more && len(commits) > 0 {
+		info.Next = commits[len(commits)-1].Hash
+	}
+	return commits, info, nil
+}
+
+// matchExpr builds the full-text match expression for the text fields of
+// q. Each word is quoted so that FTS5 syntax in it is taken literally, and
+// matches as a prefix. It reports false if a field was given with nothing
+// in it to match, such as only punctuation, which no commit matches.
+func matchExpr(q Query) (string, bool) {
+	var terms []string
+	ok := true
+	add := func(columns, text string) {
+		n := len(terms)
+		for _, word := range strings.Fields(text) {
+			// Words without letters or digits have no tokens to match.
+			if strings.IndexFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+				continue
+			}
+			terms = append(terms, columns+` : "`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+		}
+		if strings.TrimSpace(text) != "" && len(terms) == n {
+			ok = false
+		}
+	}
+	add("message", q.Text)
+	add("{author author_email}", q.Author)
+	add("{committer committer_email}", q.Committer)
+	return strings.Join(terms, " AND "), ok
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,6 +15,9 @@ import (
 type SSHConfig struct {
 	ListenAddr  string `yaml:"listen_addr"`
 	HostKeyPath string `yaml:"host_key_path"`
+	// AllowAnonymous accepts unknown keys and keyboard-interactive logins
+	// as anonymous sessions that may only clone public repositories.
+	AllowAnonymous bool `yaml:"allow_anonymous"`
 }
 
 // HTTPConfig is the configuration for the HTTP server.
@@ -23,12 +28,37 @@ type HTTPConfig struct {
 	TLSKeyPath  string `yaml:"tls_key_path"`
 }
 
+// GitDaemonConfig is the configuration for the optional git:// daemon,
+// which serves anonymous read-only clones of public repositories.
+type GitDaemonConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	ListenAddr     string        `yaml:"listen_addr"`
+	MaxConnections int           `yaml:"max_connections"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+// ArchiveConfig controls which archive formats clients may request and
+// how much disk the archive cache may use.
+type ArchiveConfig struct {
+	Formats []string `yaml:"formats"`
+	// CacheMaxMB bounds the archive cache; 0 disables caching.
+	CacheMaxMB int64 `yaml:"cache_max_mb"`
+}
+
+// ReleasesConfig controls release asset uploads.
+type ReleasesConfig struct {
+	MaxAssetMB int64 `yaml:"max_asset_mb"`
+}
+
 // Config is the top-level configuration for Origin.
 type Config struct {
-	Name     string     `yaml:"name"`
-	DataPath string     `yaml:"data_path"`
-	SSH      SSHConfig  `yaml:"ssh"`
-	HTTP     HTTPConfig `yaml:"http"`
+	Name      string          `yaml:"name"`
+	DataPath  string          `yaml:"data_path"`
+	SSH       SSHConfig       `yaml:"ssh"`
+	HTTP      HTTPConfig      `yaml:"http"`
+	GitDaemon GitDaemonConfig `yaml:"git_daemon"`
+	Archive   ArchiveConfig   `yaml:"archive"`
+	Releases  ReleasesConfig  `yaml:"releases"`
 }
 
 // DefaultConfig returns the default configuration.
@@ -43,6 +73,18 @@ func DefaultConfig() *Config {
 			ListenAddr: ":3443",
 			PublicURL:  "https://localhost:3443",
 		},
+		GitDaemon: GitDaemonConfig{
+			ListenAddr:     ":9418",
+			MaxConnections: 32,
+			Timeout:        30 * time.Second,
+		},
+		Archive: ArchiveConfig{
+			Formats:    []string{"tar", "tar.gz", "tar.xz", "zip"},
+			CacheMaxMB: 1024,
+		},
+		Releases: ReleasesConfig{
+			MaxAssetMB: 2048,
+		},
 	}
 }
 
@@ -92,6 +134,9 @@ func parseEnv(cfg *Config) {
 	if v := os.Getenv("ORIGIN_SSH_HOST_KEY_PATH"); v != "" {
 		cfg.SSH.HostKeyPath = v
 	}
+	if v := os.Getenv("ORIGIN_SSH_ALLOW_ANONYMOUS"); v != "" {
+		cfg.SSH.AllowAnonymous, _ = strconv.ParseBool(v)
+	}
 	if v := os.Getenv("ORIGIN_HTTP_LISTEN_ADDR"); v != "" {
 		cfg.HTTP.ListenAddr = v
 	}
@@ -104,6 +149,12 @@ func parseEnv(cfg *Config) {
 	if v := os.Getenv("ORIGIN_HTTP_TLS_KEY_PATH"); v != "" {
 		cfg.HTTP.TLSKeyPath = v
 	}
+	if v := os.Getenv("ORIGIN_GIT_DAEMON_ENABLED"); v != "" {
+		cfg.GitDaemon.Enabled, _ = strconv.ParseBool(v)
+	}
+	if v := os.Getenv("ORIGIN_GIT_DAEMON_LISTEN_ADDR"); v != "" {
+		cfg.GitDaemon.ListenAddr = v
+	}
 }
 
 // Validate checks the config for consistency and resolves relative paths
@@ -134,9 +185,44 @@ func (c *Config) Validate() error {
 		c.HTTP.TLSKeyPath = filepath.Join(c.DataPath, c.HTTP.TLSKeyPath)
 	}
 
+	if c.Archive.CacheMaxMB < 0 {
+		return fmt.Errorf("archive.cache_max_mb must not be negative")
+	}
+
+	if c.Releases.MaxAssetMB <= 0 {
+		return fmt.Errorf("releases.max_asset_mb must be positive")
+	}
+
+	if c.GitDaemon.Enabled {
+		if c.GitDaemon.MaxConnections <= 0 {
+			return fmt.Errorf("git_daemon.max_connections must be positive")
+		}
+		// upload-pack takes the timeout in whole seconds, where 0 is none.
+		if c.GitDaemon.Timeout < time.Second {
+			return fmt.Errorf("git_daemon.timeout must be at least 1s")
+		}
+	}
+
 	return nil
 }
 
+// ArchiveFormatAllowed reports whether clients may request archives in
+// the given format. "tgz" is accepted as an alias for "tar.gz".
+func (c *Config) ArchiveFormatAllowed(format string) bool {
+	if format == "tgz" {
+		format = "tar.gz"
+	}
+	for _, f := range c.Archive.Formats {
+		if f == "tgz" {
+			f = "tar.gz"
+		}
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
 // ReposPath returns the path to the repositories directory.
 func (c *Config) ReposPath() string {
 	return filepath.Join(c.DataPath, "repos")
@@ -177,10 +263,9 @@ func (c *Config) HasTLS() bool {
 	return c.HTTP.TLSCertPath != "" && c.HTTP.TLSKeyPath != ""
 }
 
-// SSHCloneBase returns the base SSH URL for clone commands, e.g. "ssh://git.example.com:22222".
-// It extracts the hostname from the HTTP public URL and combines it with the SSH listen port.
-func (c *Config) SSHCloneBase() string {
-	// Extract hostname from public URL (e.g. "https://git.example.com:3443" → "git.example.com")
+// PublicHost returns the hostname of the HTTP public URL,
+// e.g. "https://git.example.com:3443" → "git.example.com".
+func (c *Config) PublicHost() string {
 	host := c.HTTP.PublicURL
 	// Strip scheme
 	if idx := strings.Index(host, "://"); idx >= 0 {
@@ -190,6 +275,29 @@ func (c *Config) SSHCloneBase() string {
 	if idx := strings.IndexAny(host, ":/"); idx >= 0 {
 		host = host[:idx]
 	}
+	return host
+}
+
+// GitCloneBase returns the base git:// URL for clone commands, e.g. "git://git.example.com".
+// It returns "" when the git daemon is disabled.
+func (c *Config) GitCloneBase() string {
+	if !c.GitDaemon.Enabled {
+		return ""
+	}
+	port := c.GitDaemon.ListenAddr
+	if idx := strings.LastIndex(port, ":"); idx >= 0 {
+		port = port[idx+1:]
+	}
+	if port == "9418" {
+		return "git://" + c.PublicHost()
+	}
+	return "git://" + c.PublicHost() + ":" + port
+}
+
+// SSHCloneBase returns the base SSH URL for clone commands, e.g. "ssh://git.example.com:22222".
+// It extracts the hostname from the HTTP public URL and combines it with the SSH listen port.
+func (c *Config) SSHCloneBase() string {
+	host := c.PublicHost()
 
 	// Extract port from SSH listen addr
 	port := c.SSH.ListenAddr
@@ -0,0 +1,203 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/wbrijesh/origin/internal/config"
+	"github.com/wbrijesh/origin/internal/db"
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+)
+
+// Server is the git:// daemon. It serves git-upload-pack for public
+// repositories only; there is no authentication on this transport.
+type Server struct {
+	cfg *config.Config
+	db  *sqlx.DB
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+
+	// ctx is cancelled on Close, terminating in-flight transfers.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// slots bounds the number of concurrent connections.
+	slots chan struct{}
+}
+
+// New creates a new git daemon.
+func New(cfg *config.Config, db *sqlx.DB) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		cfg:    cfg,
+		db:     db,
+		ctx:    ctx,
+		cancel: cancel,
+		slots:  make(chan struct{}, cfg.GitDaemon.MaxConnections),
+	}
+}
+
+// ListenAndServe starts the git daemon.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.cfg.GitDaemon.ListenAddr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	slog.Info("git daemon listening", "addr", s.cfg.GitDaemon.ListenAddr)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			slog.Warn("git daemon: connection limit reached", "remote", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer func() { <-s.slots }()
+			defer conn.Close()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections and aborts active transfers.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	ln := s.listener
+	s.mu.Unlock()
+
+	s.cancel()
+	if ln != nil {
+		return ln.Close()
+	}
+	return nil
+}
+
+// handleConn reads the initial request line and runs upload-pack.
+// The request is a single pkt-line of the form
+//
+//	git-upload-pack /repo.git\0host=example.com\0\0version=2\0
+//
+// where the parameters after the double NUL are protocol extras.
+func (s *Server) handleConn(conn net.Conn) {
+	timeout := s.cfg.GitDaemon.Timeout
+
+	conn.SetReadDeadline(time.Now().Add(timeout)) //nolint:errcheck
+	line, err := gitpkg.ReadPktline(conn)
+	if err != nil {
+		slog.Debug("git daemon: read request", "remote", conn.RemoteAddr(), "error", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{}) //nolint:errcheck
+
+	command, protocol := parseRequest(line)
+	serviceName, path, ok := strings.Cut(command, " ")
+	if !ok || serviceName != gitpkg.UploadPackService.String() {
+		gitpkg.WritePktline(conn, "ERR service not enabled: "+serviceName) //nolint:errcheck
+		return
+	}
+
+	repoName := sanitizeRepoName(path)
+	if !db.CanReadRepo(s.db, repoName, false) { // git:// is unauthenticated
+		gitpkg.WritePktline(conn, "ERR access denied or repository not exported: "+path) //nolint:errcheck
+		return
+	}
+
+	slog.Info("git daemon",
+		"service", serviceName,
+		"repo", repoName,
+		"remote", conn.RemoteAddr(),
+	)
+
+	stdin, fetch := gitpkg.InspectFetch(conn)
+
+	// upload-pack enforces the idle timeout for the rest of the transfer.
+	cmd := gitpkg.ServiceCommand{
+		Dir:      filepath.Join(s.cfg.ReposPath(), repoName+".git"),
+		Args:     []string{"--strict", "--timeout=" + strconv.Itoa(int(math.Ceil(timeout.Seconds())))},
+		Protocol: protocol,
+		Stdin:    stdin,
+		Stdout:   conn,
+	}
+	if err := gitpkg.UploadPackService.Run(s.ctx, cmd); err != nil {
+		slog.Error("git daemon: upload-pack failed", "repo", repoName, "error", err)
+		return
+	}
+
+	if fetch.Wants > 0 {
+		if err := db.RecordFetch(s.db, repoName, fetch.Filter, fetch.Shallow); err != nil {
+			slog.Error("record fetch", "repo", repoName, "error", err)
+		}
+	}
+}
+
+// parseRequest splits the daemon request line into the command
+// ("git-upload-pack /repo.git") and the sanitized extra parameters,
+// joined the way git-daemon passes them on in GIT_PROTOCOL.
+func parseRequest(line string) (string, string) {
+	command, rest, _ := strings.Cut(line, "\x00")
+
+	// Skip the host parameter, which clients may leave out; extras
+	// follow an empty field.
+	fields := strings.Split(rest, "\x00")
+	if strings.HasPrefix(fields[0], "host=") {
+		fields = fields[1:]
+	}
+	var extras []string
+	for i, f := range fields {
+		if f == "" {
+			extras = fields[i+1:]
+			break
+		}
+	}
+
+	var params []string
+	for _, e := range extras {
+		if e != "" {
+			params = append(params, e)
+		}
+	}
+	return command, gitpkg.SanitizeProtocol(strings.Join(params, ":"))
+}
+
+// sanitizeRepoName cleans up a repository path from a daemon request.
+// Clients send paths like '/my-repo.git' or '/my-repo'.
+func sanitizeRepoName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	name = strings.TrimSuffix(name, "/")
+	name = strings.TrimSuffix(name, ".git")
+	return filepath.Clean(name)
+}
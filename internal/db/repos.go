@@ -0,0 +1,15 @@
+package db
+
+import "github.com/jmoiron/sqlx"
+
+// CanReadRepo reports whether a repository exists and may be read:
+// public repositories by anyone, private ones only by clients that
+// authenticated, with a session, an access token or a registered SSH key.
+// Every transport and the web UI check access to a repository with it.
+func CanReadRepo(db *sqlx.DB, name string, authenticated bool) bool {
+	var isPrivate bool
+	if err := db.Get(&isPrivate, "SELECT is_private FROM repositories WHERE name = ?", name); err != nil {
+		return false // repo doesn't exist
+	}
+	return !isPrivate || authenticated
+}
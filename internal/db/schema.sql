@@ -45,3 +45,125 @@ CREATE TABLE IF NOT EXISTS sessions (
     expires_at DATETIME NOT NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
+
+CREATE TABLE IF NOT EXISTS fetch_stats (
+    repo_id          INTEGER PRIMARY KEY REFERENCES repositories(id) ON DELETE CASCADE,
+    fetches          INTEGER DEFAULT 0,
+    filtered_fetches INTEGER DEFAULT 0,
+    shallow_fetches  INTEGER DEFAULT 0,
+    last_filter      TEXT DEFAULT '',
+    last_filtered_at DATETIME,
+    last_fetch_at    DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS releases (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    repo_id       INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    tag           TEXT NOT NULL,
+    title         TEXT NOT NULL DEFAULT '',
+    notes         TEXT DEFAULT '',
+    is_draft      INTEGER DEFAULT 0,
+    is_prerelease INTEGER DEFAULT 0,
+    published_at  DATETIME,
+    created_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (repo_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS release_assets (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    release_id   INTEGER NOT NULL REFERENCES releases(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    size         INTEGER NOT NULL,
+    content_type TEXT NOT NULL,
+    sha256       TEXT NOT NULL,
+    downloads    INTEGER DEFAULT 0,
+    created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (release_id, name)
+);
+
+-- Replaced by dir_last_commits, which is keyed by commit, not tree.
+DROP TABLE IF EXISTS last_commits;
+
+CREATE TABLE IF NOT EXISTS dir_last_commits (
+    repo_id      INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    dir_commit   TEXT NOT NULL, -- commit that last changed the directory
+    path         TEXT NOT NULL,
+    entry        TEXT NOT NULL,
+    commit_hash  TEXT NOT NULL,
+    author       TEXT NOT NULL,
+    author_email TEXT NOT NULL,
+    authored_at  DATETIME NOT NULL,
+    summary      TEXT NOT NULL,
+    PRIMARY KEY (repo_id, dir_commit, path, entry)
+);
+
+CREATE TABLE IF NOT EXISTS commit_index (
+    id              INTEGER PRIMARY KEY,
+    repo_id         INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    hash            TEXT NOT NULL,
+    author          TEXT NOT NULL,
+    author_email    TEXT NOT NULL,
+    authored_at     INTEGER NOT NULL, -- unix seconds
+    committer       TEXT NOT NULL,
+    committer_email TEXT NOT NULL,
+    committed_at    INTEGER NOT NULL, -- unix seconds
+    parents         TEXT NOT NULL,
+    message         TEXT NOT NULL,
+    UNIQUE (repo_id, hash)
+);
+
+CREATE INDEX IF NOT EXISTS commit_index_committed ON commit_index (repo_id, committed_at);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS commit_index_fts USING fts5(
+    message, author, author_email, committer, committer_email,
+    content='commit_index', content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS commit_index_insert AFTER INSERT ON commit_index BEGIN
+    INSERT INTO commit_index_fts (rowid, message, author, author_email, committer, committer_email)
+    VALUES (new.id, new.message, new.author, new.author_email, new.committer, new.committer_email);
+END;
+
+CREATE TRIGGER IF NOT EXISTS commit_index_delete AFTER DELETE ON commit_index BEGIN
+    INSERT INTO commit_index_fts (commit_index_fts, rowid, message, author, author_email, committer, committer_email)
+    VALUES ('delete', old.id, old.message, old.author, old.author_email, old.committer, old.committer_email);
+END;
+
+CREATE TABLE IF NOT EXISTS commit_index_tips (
+    repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    hash    TEXT NOT NULL,
+    PRIMARY KEY (repo_id, hash)
+);
+
+CREATE TABLE IF NOT EXISTS repo_stats (
+    repo_id     INTEGER PRIMARY KEY REFERENCES repositories(id) ON DELETE CASCADE,
+    commit_hash TEXT NOT NULL, -- default branch commit the stats describe
+    files       INTEGER NOT NULL,
+    size        INTEGER NOT NULL, -- bytes on disk
+    commits     INTEGER NOT NULL,
+    computed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS repo_languages (
+    repo_id  INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    language TEXT NOT NULL,
+    bytes    INTEGER NOT NULL,
+    files    INTEGER NOT NULL,
+    PRIMARY KEY (repo_id, language)
+);
+
+CREATE TABLE IF NOT EXISTS repo_contributors (
+    repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    rank    INTEGER NOT NULL,
+    name    TEXT NOT NULL,
+    email   TEXT NOT NULL,
+    commits INTEGER NOT NULL,
+    PRIMARY KEY (repo_id, rank)
+);
+
+CREATE TABLE IF NOT EXISTS repo_activity (
+    repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    day     TEXT NOT NULL, -- YYYY-MM-DD
+    commits INTEGER NOT NULL,
+    PRIMARY KEY (repo_id, day)
+);
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RecordFetch bumps the upload-pack counters for a repository after a
+// fetch has been served. It is shared by every git transport so the admin
+// view reflects partial and shallow clones regardless of how they arrive.
+func RecordFetch(db *sqlx.DB, repoName, filter string, shallow bool) error {
+	filtered := 0
+	if filter != "" {
+		filtered = 1
+	}
+	shallowInt := 0
+	if shallow {
+		shallowInt = 1
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO fetch_stats (repo_id, fetches, filtered_fetches, shallow_fetches, last_filter, last_filtered_at, last_fetch_at)
+		SELECT id, 1, ?, ?, ?, CASE WHEN ? = 1 THEN CURRENT_TIMESTAMP END, CURRENT_TIMESTAMP
+		FROM repositories WHERE name = ?
+		ON CONFLICT(repo_id) DO UPDATE SET
+			fetches          = fetches + 1,
+			filtered_fetches = filtered_fetches + excluded.filtered_fetches,
+			shallow_fetches  = shallow_fetches + excluded.shallow_fetches,
+			last_filter      = CASE WHEN excluded.filtered_fetches > 0 THEN excluded.last_filter ELSE last_filter END,
+			last_filtered_at = COALESCE(excluded.last_filtered_at, last_filtered_at),
+			last_fetch_at    = excluded.last_fetch_at`,
+		filtered, shallowInt, filter, filtered, repoName,
+	)
+	if err != nil {
+		return fmt.Errorf("record fetch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/ulikunitz/xz"
+)
+
+// ArchiveFormats lists the formats Archive.Write can produce, by the file
+// extension each one is served under.
+var ArchiveFormats = []string{"tar.gz", "tar.xz", "zip", "tar"}
+
+// ArchiveContentType returns the MIME type for an archive format.
+func ArchiveContentType(format string) string {
+	switch format {
+	case "tar.gz", "tgz":
+		return "application/gzip"
+	case "tar.xz":
+		return "application/x-xz"
+	case "zip":
+		return "application/zip"
+	default:
+		return "application/x-tar"
+	}
+}
+
+// Archive is a tree (or subdirectory of a tree) at a resolved commit,
+// ready to be written out in any of the ArchiveFormats.
+type Archive struct {
+	Commit plumbing.Hash
+	Time   time.Time
+	Path   string
+
+	repo *git.Repository
+	tree *object.Tree
+}
+
+// OpenArchive resolves ref and, if subpath is non-empty, the directory
+// within it that the archive should contain.
+func OpenArchive(repo *git.Repository, ref, subpath string) (*Archive, error) {
+	commit, err := ResolveCommit(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get tree: %w", err)
+	}
+
+	subpath = strings.Trim(path.Clean("/"+subpath), "/")
+	if subpath != "" {
+		tree, err = tree.Tree(subpath)
+		if err != nil {
+			return nil, fmt.Errorf("path not found: %s", subpath)
+		}
+	}
+
+	return &Archive{
+		Commit: commit.Hash,
+		Time:   commit.Committer.When,
+		Path:   subpath,
+		repo:   repo,
+		tree:   tree,
+	}, nil
+}
+
+// Write streams the archive to w in the given format. Every entry is placed
+// under prefix (e.g. "repo-v1.0/"). Entries keep their path from the
+// repository root, modes follow git archive (0664/0775 files, symlinks
+// stored as links, submodules as empty directories) and every timestamp is
+// the commit time, so the same commit always yields the same bytes.
+func (a *Archive) Write(w io.Writer, format, prefix string) error {
+	switch format {
+	case "tar":
+		return a.writeTar(w, prefix)
+	case "tar.gz", "tgz":
+		gz := gzip.NewWriter(w)
+		if err := a.writeTar(gz, prefix); err != nil {
+			return err
+		}
+		return gz.Close()
+	case "tar.xz":
+		xw, err := xz.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := a.writeTar(xw, prefix); err != nil {
+			return err
+		}
+		return xw.Close()
+	case "zip":
+		return a.writeZip(w, prefix)
+	default:
+		return fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+// archiveEntry is a single file, symlink or directory in an archive.
+type archiveEntry struct {
+	name string
+	mode filemode.FileMode
+	blob *object.Blob // nil for directories and submodules
+}
+
+// walk calls fn for every entry in the archive, parents before children.
+func (a *Archive) walk(fn func(archiveEntry) error) error {
+	if a.Path != "" {
+		// Emit the leading directories so extractors create them with
+		// the right mode and time.
+		parts := strings.Split(a.Path, "/")
+		for i := range parts {
+			dir := strings.Join(parts[:i+1], "/")
+			if err := fn(archiveEntry{name: dir, mode: filemode.Dir}); err != nil {
+				return err
+			}
+		}
+	}
+	return a.walkTree(a.tree, a.Path, fn)
+}
+
+func (a *Archive) walkTree(tree *object.Tree, dir string, fn func(archiveEntry) error) error {
+	for _, e := range tree.Entries {
+		name := e.Name
+		if dir != "" {
+			name = dir + "/" + e.Name
+		}
+
+		switch e.Mode {
+		case filemode.Dir:
+			if err := fn(archiveEntry{name: name, mode: filemode.Dir}); err != nil {
+				return err
+			}
+			sub, err := a.repo.TreeObject(e.Hash)
+			if err != nil {
+				return fmt.Errorf("get tree %s: %w", name, err)
+			}
+			if err := a.walkTree(sub, name, fn); err != nil {
+				return err
+			}
+		case filemode.Submodule:
+			if err := fn(archiveEntry{name: name, mode: filemode.Submodule}); err != nil {
+				return err
+			}
+		default:
+			blob, err := a.repo.BlobObject(e.Hash)
+			if err != nil {
+				return fmt.Errorf("get blob %s: %w", name, err)
+			}
+			if err := fn(archiveEntry{name: name, mode: e.Mode, blob: blob}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Archive) writeTar(w io.Writer, prefix string) error {
+	tw := tar.NewWriter(w)
+
+	// Like git archive, record the commit in a pax global header so
+	// `git get-tar-commit-id` works on our tarballs.
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": a.Commit.String()},
+	}); err != nil {
+		return err
+	}
+
+	if prefix != "" {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     prefix,
+			Mode:     0o775,
+			ModTime:  a.Time,
+		}); err != nil {
+			return err
+		}
+	}
+
+	err := a.walk(func(e archiveEntry) error {
+		hdr := &tar.Header{
+			Name:    prefix + e.name,
+			ModTime: a.Time,
+		}
+		switch e.mode {
+		case filemode.Dir, filemode.Submodule:
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			hdr.Mode = 0o775
+			return tw.WriteHeader(hdr)
+		case filemode.Symlink:
+			target, err := readBlob(e.blob)
+			if err != nil {
+				return err
+			}
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = target
+			hdr.Mode = 0o777
+			return tw.WriteHeader(hdr)
+		}
+
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = e.blob.Size
+		hdr.Mode = 0o664
+		if e.mode == filemode.Executable {
+			hdr.Mode = 0o775
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		return copyBlob(tw, e.blob)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (a *Archive) writeZip(w io.Writer, prefix string) error {
+	zw := zip.NewWriter(w)
+	if err := zw.SetComment(a.Commit.String()); err != nil {
+		return err
+	}
+
+	if prefix != "" {
+		if _, err := zw.CreateHeader(zipHeader(prefix, fs.ModeDir|0o775, a.Time)); err != nil {
+			return err
+		}
+	}
+
+	err := a.walk(func(e archiveEntry) error {
+		name := prefix + e.name
+		switch e.mode {
+		case filemode.Dir, filemode.Submodule:
+			_, err := zw.CreateHeader(zipHeader(name+"/", fs.ModeDir|0o775, a.Time))
+			return err
+		case filemode.Symlink:
+			fw, err := zw.CreateHeader(zipHeader(name, fs.ModeSymlink|0o777, a.Time))
+			if err != nil {
+				return err
+			}
+			return copyBlob(fw, e.blob)
+		}
+
+		var mode fs.FileMode = 0o664
+		if e.mode == filemode.Executable {
+			mode = 0o775
+		}
+		hdr := zipHeader(name, mode, a.Time)
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		return copyBlob(fw, e.blob)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func zipHeader(name string, mode fs.FileMode, modTime time.Time) *zip.FileHeader {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Modified: modTime,
+		Method:   zip.Store,
+	}
+	hdr.SetMode(mode)
+	return hdr
+}
+
+func copyBlob(w io.Writer, blob *object.Blob) error {
+	r, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func readBlob(blob *object.Blob) (string, error) {
+	var sb strings.Builder
+	if err := copyBlob(&sb, blob); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,283 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// BlameHunk is a run of consecutive lines last changed by the same commit.
+// The commit's Message holds only its summary line, and Path is the name
+// the file had in that commit.
+type BlameHunk struct {
+	Commit    CommitInfo
+	Path      string
+	StartLine int
+	Lines     []string
+}
+
+// FileCommit is a commit in the history of a file, with the path the file
+// had in that commit.
+type FileCommit struct {
+	CommitInfo
+	Path string
+
+	renamedFrom string // the file's name before the commit, if it renamed it
+}
+
+// Blame returns line-level authorship of path as of commit. It runs
+// git blame, which go-git's implementation is too slow for on large files.
+func Blame(ctx context.Context, repoPath string, commit plumbing.Hash, path string) ([]BlameHunk, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "blame", "--porcelain", commit.String(), "--", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git blame: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseBlame(out)
+}
+
+// parseBlame parses `git blame --porcelain`. Each line starts with a header
+// "<hash> <orig-line> <final-line> [<count>]"; the first time a commit
+// appears its author and summary follow, then the line itself prefixed by
+// a tab.
+func parseBlame(out []byte) ([]BlameHunk, error) {
+	commits := make(map[string]*CommitInfo)
+	var hunks []BlameHunk
+	var cur *CommitInfo
+	var file string
+	var lineNo int
+
+	r := bufio.NewReader(bytes.NewReader(out))
+	for {
+		line, err := r.ReadString('\n')
+		if line == "" && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if text, ok := strings.CutPrefix(line, "\t"); ok {
+			if cur == nil {
+				return nil, fmt.Errorf("parse blame: line before header")
+			}
+			n := len(hunks)
+			if n > 0 && hunks[n-1].Commit.Hash == cur.Hash && hunks[n-1].Path == file && hunks[n-1].StartLine+len(hunks[n-1].Lines) == lineNo {
+				hunks[n-1].Lines = append(hunks[n-1].Lines, text)
+			} else {
+				hunks = append(hunks, BlameHunk{Commit: *cur, Path: file, StartLine: lineNo, Lines: []string{text}})
+			}
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		if len(key) == 40 && plumbing.IsHash(key) {
+			fields := strings.Fields(value)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("parse blame: bad header %q", line)
+			}
+			lineNo, _ = strconv.Atoi(fields[1])
+			if cur = commits[key]; cur == nil {
+				cur = &CommitInfo{Hash: key, ShortHash: key[:7]}
+				commits[key] = cur
+			}
+			continue
+		}
+
+		if cur == nil {
+			continue
+		}
+		switch key {
+		case "author":
+			cur.Author = value
+		case "author-mail":
+			cur.AuthorEmail = strings.Trim(value, "<>")
+		case "author-time":
+			if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+				cur.Date = time.Unix(sec, 0)
+			}
+		case "summary":
+			cur.Message = value
+		case "filename":
+			file = value
+		}
+	}
+
+	return hunks, nil
+}
+
+// FileLog returns a page of the history of path from commit, newest
+// first, following the file across renames. Like Log, each page resumes
+// the walk where the page before it stopped.
+func FileLog(ctx context.Context, repoPath string, commit plumbing.Hash, path string, page Page) ([]FileCommit, PageInfo, error) {
+	if page.Before != "" {
+		return fileLogBefore(ctx, repoPath, commit.String(), path, page)
+	}
+
+	from, follow, err := resumeFrom(commit.String(), page)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	if follow == "" {
+		follow = path
+	}
+	var commits []FileCommit
+	err = walkLog(ctx, repoPath, func(c *FileCommit) bool {
+		commits = append(commits, *c)
+		return len(commits) <= page.Size // one extra to see if there's a next page
+	}, fileLogArgs(from, follow)...)
+	if err != nil {
+		return nil, PageInfo{}, cursorError(page, err)
+	}
+	fillPaths(commits, follow)
+
+	info := PageInfo{Newer: page.After != ""}
+	if len(commits) > page.Size {
+		commits = commits[:page.Size]
+		last := commits[len(commits)-1]
+		c, err := cursorAt(ctx, repoPath, from, last.Hash, true)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		if c.path = last.Path; last.renamedFrom != "" {
+			c.path = last.renamedFrom
+		}
+		if c.path == path {
+			c.path = ""
+		}
+		info.Next = c.String()
+	}
+	return commits, info, nil
+}
+
+// fileLogBefore returns a page of FileLog going back: the commits just
+// before page.Before.
+func fileLogBefore(ctx context.Context, repoPath, tip, path string, page Page) ([]FileCommit, PageInfo, error) {
+	var commits []FileCommit
+	var at *FileCommit
+	seen := 0
+	err := walkLog(ctx, repoPath, func(c *FileCommit) bool {
+		if c.Hash == page.Before {
+			at = c
+			return false
+		}
+		if commits = append(commits, *c); len(commits) > page.Size {
+			commits = commits[1:]
+		}
+		seen++
+		return true
+	}, fileLogArgs([]string{tip}, path)...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	if at == nil {
+		return nil, PageInfo{}, fmt.Errorf("%w: %s is not in the history of %s", ErrUnknownRevision, page.Before, path)
+	}
+	fillPaths(commits, path)
+
+	c, err := cursorAt(ctx, repoPath, []string{tip}, at.Hash, false)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	if at.Path != path {
+		c.path = at.Path
+	}
+	return commits, PageInfo{Next: c.String(), Newer: seen > page.Size}, nil
+}
+
+// fileLogArgs are the git log arguments listing the commits that changed
+// path in the history of the commits from, following renames.
+func fileLogArgs(from []string, path string) []string {
+	args := append([]string{"--follow", "--date-order", "--name-status"}, from...)
+	return append(args, "--", path)
+}
+
+// fillPaths gives commits git listed no file for the path being followed.
+func fillPaths(commits []FileCommit, path string) {
+	for i := range commits {
+		if commits[i].Path == "" {
+			commits[i].Path = path
+		}
+	}
+}
+
+// runLog runs git log with args and parses the commits it lists. With
+// --name-only or --name-status, each commit's Path is the first file name
+// git printed.
+func runLog(ctx context.Context, repoPath string, args ...string) ([]FileCommit, error) {
+	var commits []FileCommit
+	err := walkLog(ctx, repoPath, func(c *FileCommit) bool {
+		commits = append(commits, *c)
+		return true
+	}, args...)
+	return commits, err
+}
+
+// walkLog runs git log with args and calls fn with each commit as git
+// lists it, stopping git once fn returns false.
+func walkLog(ctx context.Context, repoPath string, fn func(*FileCommit) bool, args ...string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args = append([]string{"-C", repoPath, "log", "--format=%x1e%H%x00%an%x00%ae%x00%at%x00%P%x00%B%x00"}, args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("git log: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git log: %w", err)
+	}
+
+	stopped := false
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	sc.Split(splitRecords)
+	for !stopped && sc.Scan() {
+		fields := strings.SplitN(sc.Text(), "\x00", 7)
+		if len(fields) < 7 {
+			continue
+		}
+		sec, _ := strconv.ParseInt(fields[3], 10, 64)
+		fc := FileCommit{
+			CommitInfo: CommitInfo{
+				Hash:        fields[0],
+				ShortHash:   fields[0][:7],
+				Author:      fields[1],
+				AuthorEmail: fields[2],
+				Date:        time.Unix(sec, 0),
+				Message:     fields[5],
+				Parents:     strings.Fields(fields[4]),
+			},
+		}
+		fc.Path, _, _ = strings.Cut(strings.TrimSpace(fields[6]), "\n")
+		if status := strings.Split(fc.Path, "\t"); len(status) > 1 {
+			// --name-status: "<status>\t<path>", or for a rename or copy
+			// "<status>\t<old path>\t<new path>"
+			fc.Path = status[len(status)-1]
+			if len(status) == 3 && strings.HasPrefix(status[0], "R") {
+				fc.renamedFrom = status[1]
+			}
+		}
+		stopped = !fn(&fc)
+	}
+
+	cancel()
+	if err := cmd.Wait(); err != nil && !stopped {
+		return fmt.Errorf("git log: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// binarySniffLen is how much of a file IsBinary looks at, as git does.
+const binarySniffLen = 8000
+
+// BlobReader reads a file's content from the object store without loading
+// it into memory. It implements io.ReadSeeker so it can be served with
+// http.ServeContent; since objects are stored compressed, seeking reopens
+// the object and skips forward to the new offset.
+type BlobReader struct {
+	Hash string
+	Size int64
+
+	blob *object.Blob
+	r    io.ReadCloser
+	rpos int64 // offset of r
+	pos  int64 // offset of the next Read
+}
+
+// OpenBlob returns a reader for the file at path as of ref. The caller
+// must close it.
+func OpenBlob(repo *git.Repository, ref, path string) (*BlobReader, error) {
+	tree, err := resolveTree(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := tree.File(path)
+	if err != nil {
+		return nil, fmt.Errorf("get file %s: %w", path, err)
+	}
+
+	return &BlobReader{
+		Hash: file.Hash.String(),
+		Size: file.Size,
+		blob: &file.Blob,
+	}, nil
+}
+
+// Read reads from the current offset.
+func (b *BlobReader) Read(p []byte) (int, error) {
+	if b.pos >= b.Size {
+		return 0, io.EOF
+	}
+	if b.r == nil || b.rpos > b.pos {
+		if err := b.reopen(); err != nil {
+			return 0, err
+		}
+	}
+	if b.rpos < b.pos {
+		n, err := io.CopyN(io.Discard, b.r, b.pos-b.rpos)
+		b.rpos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := b.r.Read(p)
+	b.rpos += int64(n)
+	b.pos = b.rpos
+	return n, err
+}
+
+// Seek sets the offset of the next Read. The object is only reread when
+// that Read happens.
+func (b *BlobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += b.Size
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	b.pos = offset
+	return offset, nil
+}
+
+// Close closes the underlying object reader.
+func (b *BlobReader) Close() error {
+	if b.r == nil {
+		return nil
+	}
+	err := b.r.Close()
+	b.r = nil
+	return err
+}
+
+func (b *BlobReader) reopen() error {
+	b.Close() //nolint:errcheck
+	r, err := b.blob.Reader()
+	if err != nil {
+		return fmt.Errorf("read blob %s: %w", b.Hash, err)
+	}
+	b.r, b.rpos = r, 0
+	return nil
+}
+
+// IsBinary reports whether data looks like the start of a binary file:
+// like git, it checks for a NUL byte in the first 8000 bytes.
+func IsBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0
+}
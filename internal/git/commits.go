@@ -0,0 +1,198 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CommitRecord is a commit with its committer, as read for indexing.
+type CommitRecord struct {
+	CommitInfo
+	Committer      string
+	CommitterEmail string
+	CommitDate     time.Time
+}
+
+// RefTips returns the commits that branches and tags point at, with
+// annotated tags peeled. Tags of trees and blobs are left out.
+func RefTips(ctx context.Context, repoPath string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "for-each-ref",
+		"--format=%(objecttype) %(objectname) %(*objecttype) %(*objectname)")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	seen := make(map[string]bool)
+	var tips []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Fields(line)
+		var tip string
+		switch {
+		case len(f) >= 2 && f[0] == "commit":
+			tip = f[1]
+		case len(f) == 4 && f[2] == "commit":
+			tip = f[3]
+		}
+		if tip != "" && !seen[tip] {
+			seen[tip] = true
+			tips = append(tips, tip)
+		}
+	}
+	return tips, nil
+}
+
+// Unreachable returns the commits reachable from commits but not from
+// from, the ones a rewound or deleted ref left behind. Commits that no
+// longer exist are skipped.
+func Unreachable(ctx context.Context, repoPath string, commits, from []string) ([]string, error) {
+	var stdin strings.Builder
+	for _, c := range commits {
+		stdin.WriteString(c + "\n")
+	}
+	for _, c := range from {
+		stdin.WriteString("^" + c + "\n")
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-list", "--ignore-missing", "--stdin")
+	cmd.Stdin = strings.NewReader(stdin.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Reachable returns the set of commits reachable from from.
+func Reachable(ctx context.Context, repoPath string, from []string) (map[string]bool, error) {
+	var stdin strings.Builder
+	for _, c := range from {
+		stdin.WriteString(c + "\n")
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-list", "--stdin")
+	cmd.Stdin = strings.NewReader(stdin.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	commits := make(map[string]bool)
+	for _, h := range strings.Fields(string(out)) {
+		commits[h] = true
+	}
+	return commits, nil
+}
+
+// Existing returns those of commits that are still in the repository.
+func Existing(ctx context.Context, repoPath string, commits []string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "cat-file", "--batch-check=%(objectname)")
+	cmd.Stdin = strings.NewReader(strings.Join(commits, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var existing []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		// "<hash>", or "<hash> missing"
+		if line != "" && !strings.HasSuffix(line, " missing") {
+			existing = append(existing, line)
+		}
+	}
+	return existing, nil
+}
+
+// WalkCommits calls fn for each commit reachable from include but not
+// from exclude, newest first. Messages are the full commit messages.
+func WalkCommits(ctx context.Context, repoPath string, include, exclude []string, fn func(*CommitRecord) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stdin strings.Builder
+	for _, c := range include {
+		stdin.WriteString(c + "\n")
+	}
+	for _, c := range exclude {
+		stdin.WriteString("^" + c + "\n")
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "log", "--stdin",
+		"--format=%x1e%H%x00%an%x00%ae%x00%at%x00%P%x00%cn%x00%ce%x00%ct%x00%B")
+	cmd.Stdin = strings.NewReader(stdin.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("git log: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git log: %w", err)
+	}
+
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	sc.Split(splitRecords)
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), "\x00", 9)
+		if len(fields) < 9 {
+			continue
+		}
+		at, _ := strconv.ParseInt(fields[3], 10, 64)
+		ct, _ := strconv.ParseInt(fields[7], 10, 64)
+		rec := &CommitRecord{
+			CommitInfo: CommitInfo{
+				Hash:        fields[0],
+				ShortHash:   fields[0][:7],
+				Author:      fields[1],
+				AuthorEmail: fields[2],
+				Date:        time.Unix(at, 0),
+				Parents:     strings.Fields(fields[4]),
+				Message:     strings.TrimRight(fields[8], "\n"),
+			},
+			Committer:      fields[5],
+			CommitterEmail: fields[6],
+			CommitDate:     time.Unix(ct, 0),
+		}
+		if err := fn(rec); err != nil {
+			cancel()
+			cmd.Wait() //nolint:errcheck
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		cancel()
+		cmd.Wait() //nolint:errcheck
+		return fmt.Errorf("git log: %w", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git log: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// PathCommits returns the commits reachable from any ref that changed
+// path, a file or directory.
+func PathCommits(ctx context.Context, repoPath, path string) (map[string]bool, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-list", "--all", "--", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	commits := make(map[string]bool)
+	for _, h := range strings.Fields(string(out)) {
+		commits[h] = true
+	}
+	return commits, nil
+}
@@ -0,0 +1,104 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// MaxCompareCommits caps the commits listed by Compare; Ahead still counts
+// all of them.
+const MaxCompareCommits = 250
+
+// Comparison is the difference between two revisions.
+type Comparison struct {
+	Base      CommitInfo
+	Head      CommitInfo
+	MergeBase *CommitInfo // set for three-dot comparisons
+
+	Commits []CommitInfo // in head but not base, newest first, at most MaxCompareCommits
+	Ahead   int          // commits in head but not base
+	Behind  int          // commits in base but not head
+	Diff    *DiffResult
+}
+
+// Compare compares head against base. A three-dot comparison ("base...head")
+// diffs head against the merge base of the two, showing only what head
+// changed since it forked; a two-dot one ("base..head") diffs the two trees
+// directly.
+func Compare(ctx context.Context, repo *git.Repository, repoPath, base, head string, threeDot bool) (*Comparison, error) {
+	baseCommit, err := ResolveCommit(repo, base)
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := ResolveCommit(repo, head)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &Comparison{
+		Base: commitToInfo(baseCommit),
+		Head: commitToInfo(headCommit),
+	}
+
+	// Both ends are resolved, so git only ever sees full hashes.
+	b, h := baseCommit.Hash.String(), headCommit.Hash.String()
+
+	from := baseCommit
+	if threeDot {
+		// git merge-base reads the commit-graph, unlike walking the two
+		// histories here.
+		out, err := exec.CommandContext(ctx, "git", "-C", repoPath, "merge-base", b, h).Output()
+		if err != nil || len(bytes.TrimSpace(out)) == 0 {
+			return nil, fmt.Errorf("%w: %s and %s have no common history", ErrUnknownRevision, base, head)
+		}
+		if from, err = repo.CommitObject(plumbing.NewHash(string(bytes.TrimSpace(out)))); err != nil {
+			return nil, fmt.Errorf("merge base: %w", err)
+		}
+		info := commitToInfo(from)
+		cmp.MergeBase = &info
+	}
+
+	counts, err := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-list", "--left-right", "--count", b+"..."+h).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list: %w", err)
+	}
+	if f := strings.Fields(string(counts)); len(f) == 2 {
+		cmp.Behind, _ = strconv.Atoi(f[0])
+		cmp.Ahead, _ = strconv.Atoi(f[1])
+	}
+
+	commits, err := runLog(ctx, repoPath, "--max-count="+strconv.Itoa(MaxCompareCommits), b+".."+h)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range commits {
+		cmp.Commits = append(cmp.Commits, c.CommitInfo)
+	}
+
+	if cmp.Diff, err = diffTrees(ctx, repoPath, from.Hash.String(), h); err != nil {
+		return nil, err
+	}
+
+	return cmp, nil
+}
+
+// FormatPatch writes the commits in head but not base as an mbox of
+// patches, one per commit, as `git format-patch --stdout` does.
+func FormatPatch(ctx context.Context, repoPath string, cmp *Comparison, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "format-patch", "--stdout", cmp.Base.Hash+".."+cmp.Head.Hash)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git format-patch: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
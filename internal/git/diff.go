@@ -0,0 +1,350 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// emptyTree is the hash of the empty tree, which git knows without it
+// being stored. Root commits are diffed against it.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// Limits on the diffs that are read and parsed for display. A diff over
+// either has only its first whole files read, and is marked Truncated.
+const (
+	maxDiffBytes = 10 << 20
+	maxDiffFiles = 1000
+)
+
+// File statuses in a FileDiff.
+const (
+	StatusAdded    = "added"
+	StatusDeleted  = "deleted"
+	StatusModified = "modified"
+	StatusRenamed  = "renamed"
+	StatusCopied   = "copied"
+)
+
+// FileDiff is the diff of a single file.
+type FileDiff struct {
+	OldPath    string
+	NewPath    string
+	Status     string
+	Similarity int // percent, for renames and copies
+	OldMode    string
+	NewMode    string
+	Binary     bool
+	Combined   bool // a combined diff of a merge against all its parents
+	Additions  int
+	Deletions  int
+	Hunks      []Hunk
+}
+
+// Name returns the path the file has after the change, or before it for
+// deleted files.
+func (f *FileDiff) Name() string {
+	if f.Status == StatusDeleted {
+		return f.OldPath
+	}
+	return f.NewPath
+}
+
+// Hunk is one "@@" section of a file diff.
+type Hunk struct {
+	Header string // the full "@@ -a,b +c,d @@ context" line
+	Lines  []HunkLine
+}
+
+// HunkLine is a line of a hunk. Op is "+", "-" or " "; line numbers are
+// zero on the side the line is not present. Prefix is the line's prefix as
+// git printed it, which in a combined diff has a column per parent.
+type HunkLine struct {
+	Op      string
+	Prefix  string
+	OldLine int
+	NewLine int
+	Text    string
+}
+
+// diffTrees diffs two tree-ish hashes with git diff, detecting renames and
+// copies. Both must be full hashes; from may be emptyTree.
+func diffTrees(ctx context.Context, repoPath, from, to string) (*DiffResult, error) {
+	return runDiff(ctx, repoPath, "diff", "--no-ext-diff", "--find-renames", "--find-copies", from, to)
+}
+
+// combinedDiff returns the combined diff of a merge commit, as git show
+// prints it: only files that differ from every parent, and within them
+// only hunks where the merge result differs from all parents.
+func combinedDiff(ctx context.Context, repoPath, commit string) (*DiffResult, error) {
+	result, err := runDiff(ctx, repoPath, "diff-tree", "--cc", "--no-commit-id", commit)
+	if err != nil {
+		return nil, err
+	}
+	result.Combined = true
+	return result, nil
+}
+
+// runDiff runs a git diff command such as diff or diff-tree and parses its
+// patch, up to maxDiffBytes and maxDiffFiles.
+func runDiff(ctx context.Context, repoPath, command string, args ...string) (*DiffResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args = append([]string{"-C", repoPath, "-c", "core.quotePath=false", command, "--no-color", "--no-textconv"}, args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w", command, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git %s: %w", command, err)
+	}
+
+	out, readErr := io.ReadAll(io.LimitReader(stdout, maxDiffBytes+1))
+	tooLarge := len(out) > maxDiffBytes
+	if tooLarge {
+		// Stop git rather than read the rest.
+		cancel()
+	}
+	if err := cmd.Wait(); err != nil && !tooLarge {
+		return nil, fmt.Errorf("git %s: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("git %s: %w", command, readErr)
+	}
+
+	out, truncated := cutDiff(out, tooLarge)
+	return &DiffResult{
+		Files:     parseDiff(out),
+		Patch:     string(out),
+		Truncated: truncated,
+	}, nil
+}
+
+// cutDiff cuts the output of git diff down to its first maxDiffFiles
+// files. If the output was cut off at maxDiffBytes, the last file, which
+// the cut went through, is dropped as well.
+func cutDiff(out []byte, cutOff bool) ([]byte, bool) {
+	var starts []int // offsets of the files' "diff" lines
+	for i := 0; i < len(out); {
+		if bytes.HasPrefix(out[i:], []byte("diff --")) {
+			starts = append(starts, i)
+		}
+		n := bytes.IndexByte(out[i:], '\n')
+		if n < 0 {
+			break
+		}
+		i += n + 1
+	}
+	switch {
+	case len(starts) > maxDiffFiles:
+		return out[:starts[maxDiffFiles]], true
+	case cutOff && len(starts) > 0:
+		return out[:starts[len(starts)-1]], true
+	case cutOff:
+		return nil, true
+	}
+	return out, false
+}
+
+// WriteDiff writes the diff of a comparison as git diff prints it. Unlike
+// cmp.Diff, which is read for display, it has no size limit.
+func WriteDiff(ctx context.Context, repoPath string, cmp *Comparison, w io.Writer) error {
+	from := cmp.Base.Hash
+	if cmp.MergeBase != nil {
+		from = cmp.MergeBase.Hash
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "-c", "core.quotePath=false", "diff", "--no-color", "--no-textconv",
+		"--no-ext-diff", "--find-renames", "--find-copies", from, cmp.Head.Hash)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git diff: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// parseDiff parses the output of git diff into per-file diffs.
+func parseDiff(out []byte) []FileDiff {
+	var files []FileDiff
+	var f *FileDiff
+	var h *Hunk
+	var cols int // prefix columns: 1, or one per parent in a combined diff
+	var oldLine, newLine int
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+
+		if rest, ok := strings.CutPrefix(line, "diff --git "); ok {
+			files = append(files, FileDiff{Status: StatusModified})
+			f, h = &files[len(files)-1], nil
+			f.OldPath, f.NewPath = splitDiffHeader(rest)
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "diff --cc "); ok {
+			files = append(files, FileDiff{Status: StatusModified, Combined: true})
+			f, h = &files[len(files)-1], nil
+			f.OldPath = unquotePath(rest)
+			f.NewPath = f.OldPath
+			continue
+		}
+		if f == nil {
+			continue
+		}
+
+		if h != nil {
+			if strings.HasPrefix(line, "\\") {
+				// "\ No newline at end of file"
+				continue
+			}
+			if prefix, ok := hunkPrefix(line, cols); ok {
+				hl := HunkLine{Prefix: prefix, Text: line[len(prefix):]}
+				switch {
+				case strings.Contains(prefix, "-"):
+					hl.Op, hl.OldLine = "-", oldLine
+					f.Deletions++
+					oldLine++
+				case strings.Contains(prefix, "+"):
+					hl.Op, hl.NewLine = "+", newLine
+					f.Additions++
+					newLine++
+				default:
+					hl.Op, hl.OldLine, hl.NewLine = " ", oldLine, newLine
+					oldLine++
+					newLine++
+				}
+				if f.Combined {
+					// Old lines come from different parents.
+					hl.OldLine = 0
+				}
+				h.Lines = append(h.Lines, hl)
+				continue
+			}
+		}
+
+		if strings.HasPrefix(line, "@@") {
+			f.Hunks = append(f.Hunks, Hunk{Header: line})
+			h = &f.Hunks[len(f.Hunks)-1]
+			cols = len(line) - len(strings.TrimLeft(line, "@")) - 1
+			oldLine, newLine = parseHunkHeader(line)
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "new":
+			if mode, ok := strings.CutPrefix(value, "file mode "); ok {
+				f.Status = StatusAdded
+				f.NewMode = mode
+			} else {
+				f.NewMode = strings.TrimPrefix(value, "mode ")
+			}
+		case "deleted":
+			f.Status = StatusDeleted
+			f.OldMode = strings.TrimPrefix(value, "file mode ")
+		case "old":
+			f.OldMode = strings.TrimPrefix(value, "mode ")
+		case "similarity":
+			f.Similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(value, "index "), "%"))
+		case "rename", "copy":
+			f.Status = StatusRenamed
+			if key == "copy" {
+				f.Status = StatusCopied
+			}
+			if p, ok := strings.CutPrefix(value, "from "); ok {
+				f.OldPath = unquotePath(p)
+			} else if p, ok := strings.CutPrefix(value, "to "); ok {
+				f.NewPath = unquotePath(p)
+			}
+		case "index":
+			// "index abc..def 100644" carries the mode when it is unchanged.
+			if _, mode, ok := strings.Cut(value, " "); ok {
+				f.OldMode, f.NewMode = mode, mode
+			}
+		case "Binary":
+			f.Binary = true
+		case "---":
+			// Names with spaces get a trailing tab.
+			if p := unquotePath(strings.TrimSuffix(value, "\t")); p != "/dev/null" {
+				f.OldPath = strings.TrimPrefix(p, "a/")
+			}
+		case "+++":
+			if p := unquotePath(strings.TrimSuffix(value, "\t")); p != "/dev/null" {
+				f.NewPath = strings.TrimPrefix(p, "b/")
+			}
+		}
+	}
+	return files
+}
+
+// splitDiffHeader splits the "a/old b/new" of a diff --git line. The paths
+// are ambiguous when they contain spaces; renames and copies are corrected
+// from their own header lines, and otherwise both paths are the same.
+func splitDiffHeader(rest string) (string, string) {
+	if strings.HasPrefix(rest, `"`) {
+		if a, b, ok := strings.Cut(rest, `" `); ok {
+			return strings.TrimPrefix(unquotePath(a+`"`), "a/"), strings.TrimPrefix(unquotePath(b), "b/")
+		}
+	}
+	if n := len(rest); n >= 5 && (n-5)%2 == 0 {
+		p := rest[2 : 2+(n-5)/2]
+		if rest == "a/"+p+" b/"+p {
+			return p, p
+		}
+	}
+	a, b, _ := strings.Cut(rest, " b/")
+	return strings.TrimPrefix(a, "a/"), unquotePath(b)
+}
+
+// unquotePath undoes git's C-style quoting of unusual file names.
+func unquotePath(p string) string {
+	if len(p) >= 2 && p[0] == '"' && p[len(p)-1] == '"' {
+		if s, err := strconv.Unquote(p); err == nil {
+			return s
+		}
+	}
+	return p
+}
+
+// hunkPrefix returns the first cols characters of a hunk line, which mark
+// it as added, removed or context relative to each parent.
+func hunkPrefix(line string, cols int) (string, bool) {
+	if line == "" {
+		return "", true
+	}
+	if len(line) < cols || strings.Trim(line[:cols], " +-") != "" {
+		return "", false
+	}
+	return line[:cols], true
+}
+
+// parseHunkHeader returns the first old and new line numbers of a hunk
+// from its "@@ -a,b +c,d @@" header. A combined diff's header lists one
+// old range per parent; the first is used.
+func parseHunkHeader(header string) (int, int) {
+	oldLine, sawOld := 0, false
+	for _, field := range strings.Fields(strings.TrimLeft(header, "@")) {
+		start, _, _ := strings.Cut(field[1:], ",")
+		n, _ := strconv.Atoi(start)
+		switch field[0] {
+		case '-':
+			if !sawOld {
+				oldLine, sawOld = n, true
+			}
+		case '+':
+			return oldLine, n
+		}
+	}
+	return oldLine, 0
+}
@@ -0,0 +1,110 @@
+package git
+
+// GraphRow is the commit graph drawn beside one commit of a log. Lanes are
+// columns, numbered from 0 on the left; each line runs through half of the
+// row, from the top edge to the commit's height or from there to the
+// bottom edge.
+type GraphRow struct {
+	Column int // the lane of the commit's node
+	Width  int // lanes in use, for sizing the drawing
+	Lines  []GraphLine
+}
+
+// GraphLine is a line through the top or bottom half of a GraphRow. From
+// is the lane it starts at going down the page, To the lane it ends at.
+type GraphLine struct {
+	From, To int
+	Top      bool
+}
+
+// LayoutGraph assigns lanes to commits listed newest first, each lane
+// leading down to the next commit expected in it. A commit takes the lane
+// of its first child, or the leftmost free lane if none is on the page;
+// its first parent continues that lane, taking it over from a lane further
+// right that already leads there, and other parents get lanes of their
+// own, unless they already have one, where the lines join.
+//
+// Only the commits given are known, so a page of a longer history starts
+// with no lines coming from above.
+func LayoutGraph(commits []CommitInfo) []GraphRow {
+	rows := make([]GraphRow, len(commits))
+	var lanes []string // the commit each lane leads to, "" if free
+
+	find := func(hash string) int {
+		for i, h := range lanes {
+			if h == hash {
+				return i
+			}
+		}
+		return -1
+	}
+	claim := func(hash string) int {
+		if i := find(""); i >= 0 {
+			lanes[i] = hash
+			return i
+		}
+		lanes = append(lanes, hash)
+		return len(lanes) - 1
+	}
+
+	for n, c := range commits {
+		row := &rows[n]
+
+		col := find(c.Hash)
+		fresh := col < 0 // no child above
+		if fresh {
+			col = claim(c.Hash)
+		}
+		row.Column = col
+
+		// Top half: lanes passing by, and lanes from children meeting here.
+		for i, h := range lanes {
+			switch {
+			case h == c.Hash:
+				if !fresh || i != col {
+					row.Lines = append(row.Lines, GraphLine{From: i, To: col, Top: true})
+				}
+				lanes[i] = ""
+			case h != "":
+				row.Lines = append(row.Lines, GraphLine{From: i, To: i, Top: true})
+			}
+		}
+
+		// Bottom half: lanes passing by, then lines to the parents.
+		for i, h := range lanes {
+			if h != "" {
+				row.Lines = append(row.Lines, GraphLine{From: i, To: i})
+			}
+		}
+		for k, p := range c.Parents {
+			to := find(p)
+			switch {
+			case to < 0 && k == 0:
+				to = col
+				lanes[col] = p
+			case to < 0:
+				to = claim(p)
+			case k == 0 && to > col:
+				// The first parent's lane is further right: move it into
+				// this commit's lane rather than leave this one empty.
+				for i := range row.Lines {
+					if l := &row.Lines[i]; !l.Top && l.From == to && l.To == to {
+						l.To = col
+					}
+				}
+				lanes[col], lanes[to] = p, ""
+				to = col
+			}
+			row.Lines = append(row.Lines, GraphLine{From: col, To: to})
+		}
+
+		for len(lanes) > 0 && lanes[len(lanes)-1] == "" {
+			lanes = lanes[:len(lanes)-1]
+		}
+		for _, l := range row.Lines {
+			row.Width = max(row.Width, l.From+1, l.To+1)
+		}
+		row.Width = max(row.Width, col+1)
+	}
+	return rows
+}
@@ -0,0 +1,121 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// LastCommits returns, for each of names in the directory dir as of
+// commit, the commit that last changed it; the commits' Message holds only
+// the summary line. It reads git log for the directory until every name
+// has been seen, so entries changed recently are found without walking
+// the whole history. A merge counts as changing only the files where it
+// differs from every parent, such as resolved conflicts.
+func LastCommits(ctx context.Context, repoPath string, commit plumbing.Hash, dir string, names []string) (map[string]*CommitInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := []string{"-C", repoPath, "-c", "core.quotePath=false",
+		"log", "--no-renames", "--name-only", "--cc", "--format=%x1e%H%x00%an%x00%ae%x00%at%x00%P%x00%s%x00",
+		commit.String(),
+	}
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+		args = append(args, "--", prefix)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("git log: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git log: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, n := range names {
+		wanted[n] = true
+	}
+	result := make(map[string]*CommitInfo, len(names))
+
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	sc.Split(splitRecords)
+	for len(result) < len(wanted) && sc.Scan() {
+		fields := strings.SplitN(sc.Text(), "\x00", 7)
+		if len(fields) < 7 {
+			continue
+		}
+		var info *CommitInfo
+		for _, name := range strings.Split(strings.TrimSpace(fields[6]), "\n") {
+			name, _, _ = strings.Cut(strings.TrimPrefix(unquotePath(name), prefix), "/")
+			if !wanted[name] || result[name] != nil {
+				continue
+			}
+			if info == nil {
+				sec, _ := strconv.ParseInt(fields[3], 10, 64)
+				info = &CommitInfo{
+					Hash:        fields[0],
+					ShortHash:   fields[0][:7],
+					Author:      fields[1],
+					AuthorEmail: fields[2],
+					Date:        time.Unix(sec, 0),
+					Parents:     strings.Fields(fields[4]),
+					Message:     fields[5],
+				}
+			}
+			result[name] = info
+		}
+	}
+
+	// Stop git early once everything is found.
+	complete := len(result) == len(wanted)
+	cancel()
+	if err := cmd.Wait(); err != nil && !complete {
+		return nil, fmt.Errorf("git log: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return result, nil
+}
+
+// LastChange returns the commit that last changed the directory dir ("" for
+// the root) as of commit: the first that git log of the directory lists.
+// What LastCommits finds for the directory depends only on it, not on the
+// commits after it.
+func LastChange(ctx context.Context, repoPath string, commit plumbing.Hash, dir string) (string, error) {
+	args := []string{"-C", repoPath, "rev-list", "--max-count=1", commit.String()}
+	if dir != "" {
+		args = append(args, "--", dir+"/")
+	}
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-list: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// splitRecords is a bufio.SplitFunc for output records that start with a
+// 0x1e separator.
+func splitRecords(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	if len(data) > 0 && data[0] == '\x1e' {
+		start = 1
+	}
+	if i := bytes.IndexByte(data[start:], '\x1e'); i >= 0 {
+		return start + i, data[start : start+i], nil
+	}
+	if atEOF && len(data) > start {
+		return len(data), data[start:], nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,162 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Page selects a page of a history, newest commits first. After is the
+// Next cursor of the page before; Before is the first commit of the page
+// after, for paging back towards the newest commits. The first page has
+// neither.
+type Page struct {
+	After  string
+	Before string
+	Size   int
+}
+
+// PageInfo tells what lies around a page of a history.
+type PageInfo struct {
+	Next  string // After for the page of older commits, "" if there are none
+	Newer bool   // there are commits newer than the page's
+}
+
+// A cursor is where a walk of a history stopped: the commits it would
+// visit next, which are the parents of the commits it visited that it
+// hasn't visited yet, and the name a followed file had there, if that
+// differs from the name asked for. Histories are walked with
+// --date-order, which never visits a commit before all of its children,
+// so a walk resumed from those commits visits exactly the rest.
+type cursor struct {
+	pending []string
+	path    string
+}
+
+// String encodes c for a URL: the pending commits joined by ".", then
+// ":" and the path if there is one.
+func (c cursor) String() string {
+	if len(c.pending) == 0 {
+		return ""
+	}
+	s := strings.Join(c.pending, ".")
+	if c.path != "" {
+		s += ":" + c.path
+	}
+	return s
+}
+
+func parseCursor(s string) (cursor, error) {
+	hashes, path, _ := strings.Cut(s, ":")
+	c := cursor{path: path}
+	for _, h := range strings.Split(hashes, ".") {
+		if !plumbing.IsHash(h) {
+			return cursor{}, fmt.Errorf("%w: malformed cursor %q", ErrInvalidRevision, s)
+		}
+		c.pending = append(c.pending, h)
+	}
+	return c, nil
+}
+
+// visit moves c past a commit the walk visited.
+func (c *cursor) visit(hash string, parents []string) {
+	if i := slices.Index(c.pending, hash); i >= 0 {
+		c.pending = slices.Delete(c.pending, i, i+1)
+	}
+	for _, p := range parents {
+		if !slices.Contains(c.pending, p) {
+			c.pending = append(c.pending, p)
+		}
+	}
+}
+
+// cursorAt walks the history from the commits from until it reaches
+// hash, and returns the cursor there: before hash is visited or, with
+// through, after.
+func cursorAt(ctx context.Context, repoPath string, from []string, hash string, through bool) (cursor, error) {
+	c := cursor{pending: slices.Clone(from)}
+	found := false
+	err := revWalk(ctx, repoPath, from, func(h string, parents []string) bool {
+		if h == hash {
+			found = true
+			if through {
+				c.visit(h, parents)
+			}
+			return false
+		}
+		c.visit(h, parents)
+		return true
+	})
+	if err != nil {
+		return cursor{}, err
+	}
+	if !found {
+		return cursor{}, fmt.Errorf("%w: %s is not in the history", ErrUnknownRevision, hash)
+	}
+	return c, nil
+}
+
+// revWalk runs git rev-list --date-order from the commits from and calls
+// fn with each commit it lists and the commit's parents, stopping git
+// once fn returns false.
+func revWalk(ctx context.Context, repoPath string, from []string, fn func(hash string, parents []string) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := append([]string{"-C", repoPath, "rev-list", "--date-order", "--parents"}, from...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("git rev-list: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git rev-list: %w", err)
+	}
+
+	stopped := false
+	sc := bufio.NewScanner(stdout)
+	for !stopped && sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		stopped = !fn(fields[0], fields[1:])
+	}
+
+	// Stop git early once fn has what it needs.
+	cancel()
+	if err := cmd.Wait(); err != nil && !stopped {
+		return fmt.Errorf("git rev-list: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// resumeFrom returns the commits a page with page.After resumes the walk
+// from, and the name of the followed file there ("" if unchanged). An
+// unknown commit in the cursor is only found when git runs; errors from
+// walks resumed from a cursor are put down to it by cursorError.
+func resumeFrom(tip string, page Page) ([]string, string, error) {
+	if page.After == "" {
+		return []string{tip}, "", nil
+	}
+	c, err := parseCursor(page.After)
+	if err != nil {
+		return nil, "", err
+	}
+	return c.pending, c.path, nil
+}
+
+func cursorError(page Page, err error) error {
+	if err == nil || page.After == "" {
+		return err
+	}
+	return fmt.Errorf("%w: cursor %s: %v", ErrUnknownRevision, page.After, err)
+}
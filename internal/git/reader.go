@@ -1,16 +1,19 @@
 package git
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"io"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
@@ -23,13 +26,39 @@ type CommitInfo struct {
 	AuthorEmail string
 	Date       time.Time
 	Signature  string // SSH signature if present
+	Parents    []string // full hashes
 }
 
-// FileEntry represents a file or directory in a tree listing.
+// IsMerge reports whether the commit has more than one parent.
+func (c CommitInfo) IsMerge() bool {
+	return len(c.Parents) > 1
+}
+
+// Kinds of tree entries.
+const (
+	KindTree       = "tree"
+	KindFile       = "file"
+	KindExecutable = "executable"
+	KindSymlink    = "symlink"
+	KindSubmodule  = "submodule"
+)
+
+// FileEntry represents an entry in a tree listing.
 type FileEntry struct {
 	Name  string
-	IsDir bool
+	Kind  string
+	IsDir bool // Kind is KindTree
 	Size  int64
+
+	// Symlinks: the target as stored, and where it points within the
+	// repo if it stays inside it and exists there.
+	Target      string
+	TargetPath  string
+	TargetIsDir bool
+
+	// Submodules: the pinned commit and the URL from .gitmodules.
+	SubmoduleCommit string
+	SubmoduleURL    string
 }
 
 // RefInfo holds information about a branch or tag.
@@ -38,19 +67,33 @@ type RefInfo struct {
 	Hash      string
 	ShortHash string
 	IsTag     bool
-}
-
-// DiffStat holds per-file diff statistics.
-type DiffStat struct {
-	Name      string
-	Additions int
-	Deletions int
+	Commit    string // the commit an annotated tag points at, or Hash
 }
 
 // DiffResult holds the full diff output for a commit.
 type DiffResult struct {
-	Stats []DiffStat
-	Patch string
+	Files     []FileDiff
+	Patch     string
+	Combined  bool // a merge's combined diff against all its parents
+	Truncated bool // too large to read whole; Files and Patch have the first files
+}
+
+// Additions returns the number of added lines across all files.
+func (d *DiffResult) Additions() int {
+	n := 0
+	for i := range d.Files {
+		n += d.Files[i].Additions
+	}
+	return n
+}
+
+// Deletions returns the number of deleted lines across all files.
+func (d *DiffResult) Deletions() int {
+	n := 0
+	for i := range d.Files {
+		n += d.Files[i].Deletions
+	}
+	return n
 }
 
 // OpenRepo opens a bare git repository at the given path.
@@ -77,6 +120,7 @@ func ListRefs(repo *git.Repository) ([]RefInfo, error) {
 			Name:      ref.Name().Short(),
 			Hash:      ref.Hash().String(),
 			ShortHash: ref.Hash().String()[:7],
+			Commit:    ref.Hash().String(),
 		})
 		return nil
 	})
@@ -90,11 +134,20 @@ func ListRefs(repo *git.Repository) ([]RefInfo, error) {
 		return nil, fmt.Errorf("list tags: %w", err)
 	}
 	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+		for {
+			tag, err := repo.TagObject(target)
+			if err != nil {
+				break
+			}
+			target = tag.Target
+		}
 		refs = append(refs, RefInfo{
 			Name:      ref.Name().Short(),
 			Hash:      ref.Hash().String(),
 			ShortHash: ref.Hash().String()[:7],
 			IsTag:     true,
+			Commit:    target.String(),
 		})
 		return nil
 	})
@@ -105,126 +158,183 @@ func ListRefs(repo *git.Repository) ([]RefInfo, error) {
 	return refs, nil
 }
 
-// resolveRef resolves a ref string to a commit hash. The ref can be a branch
-// name, tag name, short hash, or full hash.
-func resolveRef(repo *git.Repository, ref string) (*plumbing.Hash, error) {
-	// Try as a branch
-	branchRef, err := repo.Reference(plumbing.NewBranchReferenceName(ref), true)
-	if err == nil {
-		h := branchRef.Hash()
-		return &h, nil
-	}
+// TagInfo is a tag with who made it and when: the tagger of an annotated
+// tag, or the author and commit date of a lightweight tag's commit.
+type TagInfo struct {
+	RefInfo
+	Tagger      string
+	TaggerEmail string
+	Date        time.Time
+	Message     string // empty for lightweight tags
+}
 
-	// Try as a tag
-	tagRef, err := repo.Reference(plumbing.NewTagReferenceName(ref), true)
-	if err == nil {
-		h := tagRef.Hash()
-		return &h, nil
+// ListTags returns the tags of a repository that point at commits, newest
+// first.
+func ListTags(repo *git.Repository) ([]TagInfo, error) {
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return nil, err
 	}
 
-	// Try as HEAD
-	if ref == "HEAD" || ref == "" {
-		headRef, err := repo.Head()
+	var tags []TagInfo
+	for _, ref := range refs {
+		if !ref.IsTag {
+			continue
+		}
+		commit, err := repo.CommitObject(plumbing.NewHash(ref.Commit))
 		if err != nil {
-			return nil, fmt.Errorf("resolve HEAD: %w", err)
+			continue
 		}
-		h := headRef.Hash()
-		return &h, nil
-	}
-
-	// Try as a hash (full or short)
-	if len(ref) >= 4 {
-		h := plumbing.NewHash(ref)
-		if h.IsZero() {
-			// Might be a short hash — iterate commits to find it
-			// For now, only support full hashes
-			return nil, fmt.Errorf("unknown ref: %s", ref)
+		info := TagInfo{
+			RefInfo:     ref,
+			Tagger:      commit.Author.Name,
+			TaggerEmail: commit.Author.Email,
+			Date:        commit.Committer.When,
+		}
+		if tag, err := repo.TagObject(plumbing.NewHash(ref.Hash)); err == nil {
+			info.Tagger = tag.Tagger.Name
+			info.TaggerEmail = tag.Tagger.Email
+			info.Date = tag.Tagger.When
+			info.Message = strings.TrimRight(tag.Message, "\n")
 		}
-		return &h, nil
+		tags = append(tags, info)
 	}
-
-	return nil, fmt.Errorf("unknown ref: %s", ref)
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Date.After(tags[j].Date) })
+	return tags, nil
 }
 
-// Log returns paginated commit history for a given ref.
-func Log(repo *git.Repository, ref string, page, perPage int) ([]CommitInfo, bool, error) {
-	hash, err := resolveRef(repo, ref)
+// Log returns a page of the history of commit, newest first. The history
+// is walked with git rev-list, which reads the commit-graph file when
+// there is one, and each page resumes the walk where the page before it
+// stopped, so pages deep in a large history stay cheap. Paging back with
+// page.Before walks from commit down to it.
+func Log(ctx context.Context, repoPath string, commit plumbing.Hash, page Page) ([]CommitInfo, PageInfo, error) {
+	var hashes []string
+	var info PageInfo
+	var err error
+	if page.Before != "" {
+		hashes, info, err = logBefore(ctx, repoPath, commit.String(), page)
+	} else {
+		hashes, info, err = logAfter(ctx, repoPath, commit.String(), page)
+	}
+	if err != nil || len(hashes) == 0 {
+		return nil, info, err
+	}
+
+	listed, err := runLog(ctx, repoPath, append([]string{"--no-walk=unsorted"}, hashes...)...)
 	if err != nil {
-		return nil, false, err
+		return nil, PageInfo{}, err
+	}
+	commits := make([]CommitInfo, len(listed))
+	for i := range listed {
+		commits[i] = listed[i].CommitInfo
 	}
+	return commits, info, nil
+}
 
-	iter, err := repo.Log(&git.LogOptions{
-		From:  *hash,
-		Order: git.LogOrderCommitterTime,
-	})
+// logAfter lists the commits of a page of Log going forward.
+func logAfter(ctx context.Context, repoPath, tip string, page Page) ([]string, PageInfo, error) {
+	from, _, err := resumeFrom(tip, page)
 	if err != nil {
-		return nil, false, fmt.Errorf("log: %w", err)
+		return nil, PageInfo{}, err
 	}
-	defer iter.Close()
-
-	// Skip to page
-	skip := page * perPage
-	for range skip {
-		if _, err := iter.Next(); err != nil {
-			return nil, false, nil // No more commits
+	c := cursor{pending: slices.Clone(from)}
+	var hashes []string
+	err = revWalk(ctx, repoPath, from, func(hash string, parents []string) bool {
+		if len(hashes) == page.Size {
+			return false
 		}
+		hashes = append(hashes, hash)
+		c.visit(hash, parents)
+		return true
+	})
+	if err != nil {
+		return nil, PageInfo{}, cursorError(page, err)
 	}
+	return hashes, PageInfo{Next: c.String(), Newer: page.After != ""}, nil
+}
 
-	var commits []CommitInfo
-	for i := 0; i < perPage+1; i++ { // fetch one extra to check if there's a next page
-		c, err := iter.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, false, fmt.Errorf("iterate log: %w", err)
+// logBefore lists the commits of a page of Log going back: the ones just
+// before page.Before.
+func logBefore(ctx context.Context, repoPath, tip string, page Page) ([]string, PageInfo, error) {
+	c := cursor{pending: []string{tip}}
+	var hashes []string
+	found, seen := false, 0
+	err := revWalk(ctx, repoPath, []string{tip}, func(hash string, parents []string) bool {
+		if hash == page.Before {
+			found = true
+			return false
 		}
-
-		if i < perPage {
-			commits = append(commits, commitToInfo(c))
+		if hashes = append(hashes, hash); len(hashes) > page.Size {
+			hashes = hashes[1:]
 		}
+		seen++
+		c.visit(hash, parents)
+		return true
+	})
+	if err != nil {
+		return nil, PageInfo{}, err
 	}
-
-	hasMore := len(commits) == perPage // we fetched perPage+1 items
-	return commits, hasMore, nil
+	if !found {
+		return nil, PageInfo{}, fmt.Errorf("%w: %s is not in the history of %s", ErrUnknownRevision, page.Before, tip)
+	}
+	return hashes, PageInfo{Next: c.String(), Newer: seen > page.Size}, nil
 }
 
 // Tree returns the directory listing at a path for a given ref.
-func Tree(repo *git.Repository, ref, path string) ([]FileEntry, error) {
-	hash, err := resolveRef(repo, ref)
+func Tree(repo *git.Repository, ref, dir string) ([]FileEntry, error) {
+	root, err := resolveTree(repo, ref)
 	if err != nil {
 		return nil, err
 	}
 
-	commit, err := repo.CommitObject(*hash)
-	if err != nil {
-		return nil, fmt.Errorf("get commit: %w", err)
-	}
-
-	tree, err := commit.Tree()
-	if err != nil {
-		return nil, fmt.Errorf("get tree: %w", err)
-	}
-
 	// Navigate to subdirectory if path is not root
-	if path != "" && path != "." && path != "/" {
-		tree, err = tree.Tree(path)
+	dir = strings.Trim(dir, "/")
+	if dir == "." {
+		dir = ""
+	}
+	tree := root
+	if dir != "" {
+		tree, err = root.Tree(dir)
 		if err != nil {
-			return nil, fmt.Errorf("get subtree %s: %w", path, err)
+			return nil, fmt.Errorf("get subtree %s: %w", dir, err)
 		}
 	}
 
+	var modules *config.Modules
 	var entries []FileEntry
 	for _, entry := range tree.Entries {
-		fe := FileEntry{
-			Name:  entry.Name,
-			IsDir: entry.Mode.IsFile() == false,
-		}
-
-		// Get file size for files
-		if !fe.IsDir {
-			f, err := tree.TreeEntryFile(&entry)
-			if err == nil {
+		fe := FileEntry{Name: entry.Name}
+
+		switch entry.Mode {
+		case filemode.Dir:
+			fe.Kind, fe.IsDir = KindTree, true
+		case filemode.Submodule:
+			fe.Kind = KindSubmodule
+			fe.SubmoduleCommit = entry.Hash.String()
+			if modules == nil {
+				modules = readModules(root)
+			}
+			for _, m := range modules.Submodules {
+				if m.Path == path.Join(dir, entry.Name) {
+					fe.SubmoduleURL = m.URL
+				}
+			}
+		case filemode.Symlink:
+			fe.Kind = KindSymlink
+			if f, err := tree.TreeEntryFile(&entry); err == nil {
+				fe.Size = f.Size
+				if target, err := f.Contents(); err == nil {
+					fe.Target = target
+					fe.TargetPath, fe.TargetIsDir = resolveSymlink(root, dir, target)
+				}
+			}
+		default:
+			fe.Kind = KindFile
+			if entry.Mode == filemode.Executable {
+				fe.Kind = KindExecutable
+			}
+			if f, err := tree.TreeEntryFile(&entry); err == nil {
 				fe.Size = f.Size
 			}
 		}
@@ -232,10 +342,12 @@ func Tree(repo *git.Repository, ref, path string) ([]FileEntry, error) {
 		entries = append(entries, fe)
 	}
 
-	// Sort: directories first, then alphabetical
+	// Sort: directories and submodules first, then alphabetical
 	sort.Slice(entries, func(i, j int) bool {
-		if entries[i].IsDir != entries[j].IsDir {
-			return entries[i].IsDir
+		di := entries[i].IsDir || entries[i].Kind == KindSubmodule
+		dj := entries[j].IsDir || entries[j].Kind == KindSubmodule
+		if di != dj {
+			return di
 		}
 		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
 	})
@@ -243,106 +355,79 @@ func Tree(repo *git.Repository, ref, path string) ([]FileEntry, error) {
 	return entries, nil
 }
 
-// Blob returns the content of a file at a given ref and path.
-func Blob(repo *git.Repository, ref, path string) (string, int64, error) {
-	hash, err := resolveRef(repo, ref)
+// readModules parses .gitmodules at the root of tree, which records the
+// URLs of the submodules pinned in the same commit. A missing or broken
+// file gives no submodules.
+func readModules(tree *object.Tree) *config.Modules {
+	modules := config.NewModules()
+	f, err := tree.File(".gitmodules")
 	if err != nil {
-		return "", 0, err
+		return modules
 	}
-
-	commit, err := repo.CommitObject(*hash)
+	content, err := f.Contents()
 	if err != nil {
-		return "", 0, fmt.Errorf("get commit: %w", err)
+		return modules
 	}
+	modules.Unmarshal([]byte(content)) //nolint:errcheck
+	return modules
+}
 
-	file, err := commit.File(path)
-	if err != nil {
-		return "", 0, fmt.Errorf("get file %s: %w", path, err)
+// resolveSymlink returns the repo path a symlink in dir points to, and
+// whether that is a directory. It returns "" for targets that are absolute,
+// leave the repo or don't exist.
+func resolveSymlink(root *object.Tree, dir, target string) (string, bool) {
+	if target == "" || strings.HasPrefix(target, "/") {
+		return "", false
 	}
-
-	content, err := file.Contents()
+	p := path.Join(dir, target)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	entry, err := root.FindEntry(p)
 	if err != nil {
-		return "", 0, fmt.Errorf("read file %s: %w", path, err)
+		return "", false
 	}
-
-	return content, file.Size, nil
+	return p, entry.Mode == filemode.Dir
 }
 
-// Diff returns the unified diff for a commit.
-func Diff(repo *git.Repository, commitHash string) (*DiffResult, *CommitInfo, error) {
-	h := plumbing.NewHash(commitHash)
-	commit, err := repo.CommitObject(h)
+// Diff returns the diff for a commit, given as any revision. parent
+// selects which parent to diff against, counting from 1; with parent 0,
+// merge commits get a combined diff of the files that differ from every
+// parent and other commits are diffed against their first parent.
+func Diff(ctx context.Context, repo *git.Repository, repoPath, rev string, parent int) (*DiffResult, *CommitInfo, error) {
+	commit, err := ResolveCommit(repo, rev)
 	if err != nil {
-		return nil, nil, fmt.Errorf("get commit: %w", err)
+		return nil, nil, err
 	}
 
 	info := commitToInfo(commit)
 
-	commitTree, err := commit.Tree()
-	if err != nil {
-		return nil, nil, fmt.Errorf("get commit tree: %w", err)
+	if parent > commit.NumParents() || parent < 0 {
+		return nil, nil, fmt.Errorf("%w: commit %s has no parent %d", ErrInvalidRevision, info.ShortHash, parent)
 	}
 
-	var parentTree *object.Tree
-	if commit.NumParents() > 0 {
-		parent, err := commit.Parent(0)
-		if err != nil {
-			return nil, nil, fmt.Errorf("get parent: %w", err)
-		}
-		parentTree, err = parent.Tree()
-		if err != nil {
-			return nil, nil, fmt.Errorf("get parent tree: %w", err)
-		}
+	var result *DiffResult
+	switch {
+	case parent == 0 && commit.NumParents() > 1:
+		result, err = combinedDiff(ctx, repoPath, info.Hash)
+	case commit.NumParents() == 0:
+		result, err = diffTrees(ctx, repoPath, emptyTree, info.Hash)
+	default:
+		result, err = diffTrees(ctx, repoPath, info.Parents[max(parent, 1)-1], info.Hash)
 	}
-
-	changes, err := object.DiffTree(parentTree, commitTree)
 	if err != nil {
-		return nil, nil, fmt.Errorf("diff tree: %w", err)
+		return nil, nil, err
 	}
-
-	patch, err := changes.Patch()
-	if err != nil {
-		return nil, nil, fmt.Errorf("generate patch: %w", err)
-	}
-
-	result := &DiffResult{}
-
-	// Build stats from patch file stats
-	for _, stat := range patch.Stats() {
-		result.Stats = append(result.Stats, DiffStat{
-			Name:      stat.Name,
-			Additions: stat.Addition,
-			Deletions: stat.Deletion,
-		})
-	}
-
-	// Get full patch text
-	var buf bytes.Buffer
-	if err := patch.Encode(&buf); err != nil {
-		return nil, nil, fmt.Errorf("encode patch: %w", err)
-	}
-	result.Patch = buf.String()
-
 	return result, &info, nil
 }
 
 // Readme tries to find and return the content of a README file at the repo root.
 func Readme(repo *git.Repository, ref string) (string, string, error) {
-	hash, err := resolveRef(repo, ref)
+	tree, err := resolveTree(repo, ref)
 	if err != nil {
 		return "", "", err
 	}
 
-	commit, err := repo.CommitObject(*hash)
-	if err != nil {
-		return "", "", fmt.Errorf("get commit: %w", err)
-	}
-
-	tree, err := commit.Tree()
-	if err != nil {
-		return "", "", fmt.Errorf("get tree: %w", err)
-	}
-
 	// Try common README filenames
 	names := []string{
 		"README.md", "readme.md", "Readme.md",
@@ -366,50 +451,6 @@ func Readme(repo *git.Repository, ref string) (string, string, error) {
 	return "", "", nil // No readme found
 }
 
-// ArchiveFile represents a file to include in a tar archive.
-type ArchiveFile struct {
-	Path    string
-	Content string
-	Size    int64
-}
-
-// Archive returns all files at the given ref for creating a tar archive.
-func Archive(repo *git.Repository, ref string) ([]ArchiveFile, error) {
-	hash, err := resolveRef(repo, ref)
-	if err != nil {
-		return nil, err
-	}
-
-	commit, err := repo.CommitObject(*hash)
-	if err != nil {
-		return nil, fmt.Errorf("get commit: %w", err)
-	}
-
-	tree, err := commit.Tree()
-	if err != nil {
-		return nil, fmt.Errorf("get tree: %w", err)
-	}
-
-	var files []ArchiveFile
-	err = tree.Files().ForEach(func(f *object.File) error {
-		content, err := f.Contents()
-		if err != nil {
-			return nil // skip unreadable files
-		}
-		files = append(files, ArchiveFile{
-			Path:    f.Name,
-			Content: content,
-			Size:    f.Size,
-		})
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("walk files: %w", err)
-	}
-
-	return files, nil
-}
-
 // DefaultBranch returns the default branch of a repository by inspecting HEAD.
 func DefaultBranch(repo *git.Repository) string {
 	head, err := repo.Head()
@@ -431,5 +472,8 @@ func commitToInfo(c *object.Commit) CommitInfo {
 	if c.PGPSignature != "" {
 		info.Signature = c.PGPSignature
 	}
+	for _, p := range c.ParentHashes {
+		info.Parents = append(info.Parents, p.String())
+	}
 	return info
 }
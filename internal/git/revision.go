@@ -0,0 +1,406 @@
+package git
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	ErrUnknownRevision = errors.New("unknown revision")
+	ErrInvalidRevision = errors.New("invalid revision")
+)
+
+// AmbiguousError is returned for an abbreviated hash that matches more
+// than one object.
+type AmbiguousError struct {
+	Prefix     string
+	Candidates []string // "a1b2c3d4e5 commit", ...
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("short hash %s is ambiguous, candidates: %s", e.Prefix, strings.Join(e.Candidates, ", "))
+}
+
+// ResolveCommit resolves a revision expression to the commit it names.
+// It understands the parts of gitrevisions(7) that make sense in a URL:
+//
+//	main, v1.0, refs/heads/main, HEAD, @   refs (branches before tags)
+//	a1b2c3d                                abbreviated hashes, 4 or more digits
+//	main@{2024-01-01}, @{2.weeks.ago}      the branch as of a date
+//	HEAD~3, main^2, v1.0^{}, v1.0^{tree}   ancestry and peeling
+//
+// Bare repositories keep no reflog, so ref@{date} walks the ref's
+// first-parent history back to the last commit made at or before date.
+func ResolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	hash, err := resolveRevision(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	return peelCommit(repo, rev, hash)
+}
+
+// resolveTree resolves a revision expression to a tree, so that tree
+// views also accept "v1.0^{tree}" or the hash of a tree.
+func resolveTree(repo *git.Repository, rev string) (*object.Tree, error) {
+	hash, err := resolveRevision(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	return peelTree(repo, rev, hash)
+}
+
+// resolveRevision resolves a revision expression to the object it names,
+// which may be a tag, commit or tree.
+func resolveRevision(repo *git.Repository, rev string) (plumbing.Hash, error) {
+	base, date, ops := splitRevision(rev)
+
+	hash, err := resolveName(repo, base)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if date != "" {
+		if hash, err = asOf(repo, rev, hash, date); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	for ops != "" {
+		op := ops[0]
+		ops = ops[1:]
+
+		if op == '^' && strings.HasPrefix(ops, "{") {
+			end := strings.IndexByte(ops, '}')
+			if end < 0 {
+				return plumbing.ZeroHash, fmt.Errorf("%w %s: unterminated ^{", ErrInvalidRevision, rev)
+			}
+			kind := ops[1:end]
+			ops = ops[end+1:]
+
+			switch kind {
+			case "":
+				hash, err = peelTags(repo, hash)
+			case "commit":
+				var c *object.Commit
+				if c, err = peelCommit(repo, rev, hash); err == nil {
+					hash = c.Hash
+				}
+			case "tree":
+				var t *object.Tree
+				if t, err = peelTree(repo, rev, hash); err == nil {
+					hash = t.Hash
+				}
+			default:
+				return plumbing.ZeroHash, fmt.Errorf("%w %s: unsupported ^{%s}", ErrInvalidRevision, rev, kind)
+			}
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			continue
+		}
+
+		// ~n and ^n; a missing n means 1
+		digits := len(ops) - len(strings.TrimLeft(ops, "0123456789"))
+		n := 1
+		if digits > 0 {
+			if n, err = strconv.Atoi(ops[:digits]); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("%w %s", ErrInvalidRevision, rev)
+			}
+			ops = ops[digits:]
+		}
+
+		commit, err := peelCommit(repo, rev, hash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if op == '~' {
+			// n-th first-parent ancestor
+			for range n {
+				if commit.NumParents() == 0 {
+					return plumbing.ZeroHash, fmt.Errorf("%w: %s goes past the root commit", ErrUnknownRevision, rev)
+				}
+				if commit, err = commit.Parent(0); err != nil {
+					return plumbing.ZeroHash, fmt.Errorf("get parent: %w", err)
+				}
+			}
+		} else if n > 0 {
+			// n-th parent; ^0 is the commit itself
+			if n > commit.NumParents() {
+				return plumbing.ZeroHash, fmt.Errorf("%w: %s has no parent %d", ErrUnknownRevision, commit.Hash.String()[:7], n)
+			}
+			if commit, err = commit.Parent(n - 1); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("get parent: %w", err)
+			}
+		}
+		hash = commit.Hash
+	}
+
+	return hash, nil
+}
+
+// splitRevision splits a revision expression such as "main@{yesterday}~2"
+// into the ref or hash it starts from, the date in @{...} and the ~ and ^
+// operators that follow.
+func splitRevision(rev string) (base, date, ops string) {
+	// Ref names cannot contain '~' or '^', so the first one starts the
+	// suffix operators.
+	base = rev
+	if i := strings.IndexAny(rev, "~^"); i >= 0 {
+		base, ops = rev[:i], rev[i:]
+	}
+
+	if strings.HasSuffix(base, "}") {
+		if i := strings.LastIndex(base, "@{"); i >= 0 {
+			base, date = base[:i], base[i+2:len(base)-1]
+		}
+	}
+	return base, date, ops
+}
+
+// SplitRefPath splits the part of a URL after /tree/, /blob/ and the like
+// into a ref and a path. Branch and tag names may contain slashes, so the
+// longest run of leading segments that names a branch or tag is the ref:
+// "release/2.1/docs/api.md" is "release/2.1" and "docs/api.md". Revision
+// suffixes stay with the ref ("release/2.1~2/docs"). If no branch or tag
+// matches, the first segment is the ref, e.g. a hash or "HEAD".
+func SplitRefPath(repo *git.Repository, refPath string) (ref, path string) {
+	segments := strings.Split(strings.Trim(refPath, "/"), "/")
+	for i := len(segments); i > 1; i-- {
+		candidate := strings.Join(segments[:i], "/")
+		if base, _, _ := splitRevision(candidate); isBranchOrTag(repo, base) {
+			return candidate, strings.Join(segments[i:], "/")
+		}
+	}
+	return segments[0], strings.Join(segments[1:], "/")
+}
+
+// isBranchOrTag reports whether name, short or in full, is a branch or tag.
+func isBranchOrTag(repo *git.Repository, name string) bool {
+	candidates := []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(name),
+		plumbing.NewTagReferenceName(name),
+	}
+	if full := plumbing.ReferenceName(name); full.IsBranch() || full.IsTag() {
+		candidates = []plumbing.ReferenceName{full}
+	}
+	for _, refName := range candidates {
+		if refName.Validate() != nil {
+			continue
+		}
+		if _, err := repo.Reference(refName, false); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveName resolves a ref name or (abbreviated) hash.
+func resolveName(repo *git.Repository, name string) (plumbing.Hash, error) {
+	if name == "" || name == "@" || name == "HEAD" {
+		head, err := repo.Head()
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("resolve HEAD: %w", err)
+		}
+		return head.Hash(), nil
+	}
+
+	candidates := []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(name),
+		plumbing.NewTagReferenceName(name),
+	}
+	if strings.HasPrefix(name, "refs/") {
+		candidates = append([]plumbing.ReferenceName{plumbing.ReferenceName(name)}, candidates...)
+	}
+	for _, refName := range candidates {
+		if ref, err := repo.Reference(refName, true); err == nil {
+			return ref.Hash(), nil
+		}
+	}
+
+	return resolveHashPrefix(repo, name)
+}
+
+var hexDigits = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// resolveHashPrefix finds the object whose hash starts with prefix. When
+// several do, commits (and tags of commits) are preferred, as every ref in
+// a URL is used as a commit; if that still leaves more than one, the
+// prefix is ambiguous.
+func resolveHashPrefix(repo *git.Repository, prefix string) (plumbing.Hash, error) {
+	if !hexDigits.MatchString(prefix) {
+		return plumbing.ZeroHash, fmt.Errorf("%w: %s", ErrUnknownRevision, prefix)
+	}
+	prefix = strings.ToLower(prefix)
+
+	// Only whole bytes can be looked up; the odd digit is checked below.
+	raw, _ := hex.DecodeString(prefix[:len(prefix)&^1])
+
+	var hashes []plumbing.Hash
+	type prefixSearcher interface {
+		HashesWithPrefix(prefix []byte) ([]plumbing.Hash, error)
+	}
+	if s, ok := repo.Storer.(prefixSearcher); ok {
+		found, err := s.HashesWithPrefix(raw)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("search objects: %w", err)
+		}
+		hashes = found
+	} else {
+		iter, err := repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("iterate objects: %w", err)
+		}
+		iter.ForEach(func(obj plumbing.EncodedObject) error { //nolint:errcheck
+			hashes = append(hashes, obj.Hash())
+			return nil
+		})
+	}
+
+	var matches, commits []plumbing.Hash
+	for _, h := range hashes {
+		if !strings.HasPrefix(h.String(), prefix) {
+			continue
+		}
+		matches = append(matches, h)
+		if c, err := peelTags(repo, h); err == nil {
+			if _, err := repo.CommitObject(c); err == nil {
+				commits = append(commits, h)
+			}
+		}
+	}
+
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(commits) == 1:
+		return commits[0], nil
+	case len(matches) == 0:
+		return plumbing.ZeroHash, fmt.Errorf("%w: %s", ErrUnknownRevision, prefix)
+	}
+
+	ambiguous := &AmbiguousError{Prefix: prefix}
+	for _, h := range matches {
+		kind := "object"
+		if obj, err := repo.Storer.EncodedObject(plumbing.AnyObject, h); err == nil {
+			kind = obj.Type().String()
+		}
+		ambiguous.Candidates = append(ambiguous.Candidates, h.String()[:min(len(prefix)+4, 40)]+" "+kind)
+	}
+	return plumbing.ZeroHash, ambiguous
+}
+
+// peelTags follows annotated tags to the object they finally point at.
+func peelTags(repo *git.Repository, hash plumbing.Hash) (plumbing.Hash, error) {
+	for {
+		tag, err := repo.TagObject(hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return hash, nil
+		}
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("get tag: %w", err)
+		}
+		hash = tag.Target
+	}
+}
+
+func peelCommit(repo *git.Repository, rev string, hash plumbing.Hash) (*object.Commit, error) {
+	hash, err := peelTags(repo, hash)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not a commit", ErrUnknownRevision, rev)
+	}
+	return commit, nil
+}
+
+func peelTree(repo *git.Repository, rev string, hash plumbing.Hash) (*object.Tree, error) {
+	hash, err := peelTags(repo, hash)
+	if err != nil {
+		return nil, err
+	}
+	if commit, err := repo.CommitObject(hash); err == nil {
+		return commit.Tree()
+	}
+	tree, err := repo.TreeObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not a tree", ErrUnknownRevision, rev)
+	}
+	return tree, nil
+}
+
+// asOf returns the last commit at or before date on the first-parent
+// history starting at hash.
+func asOf(repo *git.Repository, rev string, hash plumbing.Hash, date string) (plumbing.Hash, error) {
+	t, err := parseRevisionDate(date, time.Now())
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("%w %s: %v", ErrInvalidRevision, rev, err)
+	}
+
+	commit, err := peelCommit(repo, rev, hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for commit.Committer.When.After(t) {
+		if commit.NumParents() == 0 {
+			return plumbing.ZeroHash, fmt.Errorf("%w: no commit at or before %s", ErrUnknownRevision, t.Format(time.RFC3339))
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("get parent: %w", err)
+		}
+	}
+	return commit.Hash, nil
+}
+
+var relativeDate = regexp.MustCompile(`^(\d+)[. ]+(second|minute|hour|day|week|month|year)s?[. ]+ago$`)
+
+// parseRevisionDate parses the date of ref@{date}: an absolute date such as
+// "2024-01-31" or "2024-01-31T12:00:00Z" (UTC unless a zone is given),
+// "now", "yesterday", or a relative one such as "2.weeks.ago".
+func parseRevisionDate(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+
+	m := relativeDate.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("cannot parse date %q", s)
+	}
+	n, _ := strconv.Atoi(m[1])
+	switch m[2] {
+	case "second":
+		return now.Add(-time.Duration(n) * time.Second), nil
+	case "minute":
+		return now.Add(-time.Duration(n) * time.Minute), nil
+	case "hour":
+		return now.Add(-time.Duration(n) * time.Hour), nil
+	case "day":
+		return now.AddDate(0, 0, -n), nil
+	case "week":
+		return now.AddDate(0, 0, -7*n), nil
+	case "month":
+		return now.AddDate(0, -n, 0), nil
+	default:
+		return now.AddDate(-n, 0, 0), nil
+	}
+}
@@ -1,34 +1,50 @@
 package git
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 )
 
 // Service represents a git service type.
 type Service string
 
 const (
-	UploadPackService  Service = "git-upload-pack"
-	ReceivePackService Service = "git-receive-pack"
+	UploadPackService    Service = "git-upload-pack"
+	ReceivePackService   Service = "git-receive-pack"
+	UploadArchiveService Service = "git-upload-archive"
 )
 
 func (s Service) String() string {
 	return string(s)
 }
 
+// ReadOnly reports whether the service only reads from the repository.
+func (s Service) ReadOnly() bool {
+	return s == UploadPackService || s == UploadArchiveService
+}
+
 // ServiceCommand is a git service command that can be executed against a
 // bare repository. It wraps exec.Cmd with the right arguments for git
 // smart HTTP and SSH protocol operations.
 type ServiceCommand struct {
-	Dir    string
-	Args   []string
-	Env    []string
-	Stdin  io.Reader
-	Stdout io.Writer
-	Stderr io.Writer
+	Dir  string
+	Args []string
+	// Env holds extra environment variables, appended to the server's own.
+	Env []string
+	// Protocol is the client's requested protocol parameters (the
+	// Git-Protocol header or GIT_PROTOCOL variable), e.g. "version=2".
+	// It must already be sanitized with SanitizeProtocol.
+	Protocol string
+	Stdin    io.Reader
+	Stdout   io.Writer
+	Stderr   io.Writer
 }
 
 // Run executes the git service command.
@@ -39,7 +55,10 @@ func (s Service) Run(ctx context.Context, cmd ServiceCommand) error {
 
 	c := exec.CommandContext(ctx, "git", args...)
 	c.Dir = cmd.Dir
-	c.Env = cmd.Env
+	c.Env = append(os.Environ(), cmd.Env...)
+	if cmd.Protocol != "" {
+		c.Env = append(c.Env, "GIT_PROTOCOL="+cmd.Protocol)
+	}
 	c.Stdin = cmd.Stdin
 	c.Stdout = cmd.Stdout
 	c.Stderr = cmd.Stderr
@@ -57,6 +76,8 @@ func (s Service) subcommand() string {
 		return "upload-pack"
 	case ReceivePackService:
 		return "receive-pack"
+	case UploadArchiveService:
+		return "upload-archive"
 	default:
 		return string(s)
 	}
@@ -74,3 +95,295 @@ func WritePktline(w io.Writer, s string) error {
 	_, err = io.WriteString(w, "0000")
 	return err
 }
+
+// SanitizeProtocol filters a client-supplied Git-Protocol header or
+// GIT_PROTOCOL value down to colon-separated "key" or "key=value"
+// parameters made of safe characters. Anything else is dropped.
+func SanitizeProtocol(s string) string {
+	var params []string
+	for _, p := range strings.Split(s, ":") {
+		if p != "" && validProtocolParam(p) {
+			params = append(params, p)
+		}
+	}
+	return strings.Join(params, ":")
+}
+
+// IsProtocolV2 reports whether the sanitized protocol parameters request
+// git wire protocol version 2.
+func IsProtocolV2(protocol string) bool {
+	for _, p := range strings.Split(protocol, ":") {
+		if p == "version=2" {
+			return true
+		}
+	}
+	return false
+}
+
+func validProtocolParam(p string) bool {
+	for _, ch := range p {
+		if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '=' || ch == '.' || ch == '-' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadPktline reads a single pkt-line from r and returns its payload
+// without the trailing newline. Flush and delimiter packets read as "".
+func ReadPktline(r io.Reader) (string, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", fmt.Errorf("read pktline: %w", err)
+	}
+	size, err := strconv.ParseUint(string(hdr[:]), 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("read pktline: invalid length %q", hdr[:])
+	}
+	if size < 4 {
+		return "", nil
+	}
+	buf := make([]byte, size-4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", fmt.Errorf("read pktline: %w", err)
+	}
+	return strings.TrimSuffix(string(buf), "\n"), nil
+}
+
+// ReadArchiveArguments reads the "argument ..." pkt-lines a git archive
+// client sends to upload-archive, up to the terminating flush. It returns
+// the arguments and the raw bytes consumed, which must be replayed to
+// upload-archive ahead of the rest of the stream.
+func ReadArchiveArguments(r io.Reader) ([]string, []byte, error) {
+	var raw bytes.Buffer
+	tee := io.TeeReader(r, &raw)
+
+	var args []string
+	for {
+		line, err := ReadPktline(tee)
+		if err != nil {
+			return nil, nil, err
+		}
+		if line == "" {
+			return args, raw.Bytes(), nil
+		}
+		arg, ok := strings.CutPrefix(line, "argument ")
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected archive request line %q", line)
+		}
+		args = append(args, arg)
+	}
+}
+
+// ArchiveFormat returns the format requested by git archive arguments,
+// defaulting to "tar" like git does.
+func ArchiveFormat(args []string) string {
+	format := "tar"
+	for _, a := range args {
+		if f, ok := strings.CutPrefix(a, "--format="); ok {
+			format = f
+		}
+	}
+	return format
+}
+
+// UploadPackConfig holds the per-repository upload-pack capabilities that
+// Origin manages in each bare repo's git config. Because they live in the
+// repo itself, every transport that runs upload-pack honors them.
+type UploadPackConfig struct {
+	// AllowFilter enables partial clone (git clone --filter=...).
+	AllowFilter bool
+	// AllowAnySHA1InWant lets clients fetch any object by ID, which
+	// promisor remotes need to backfill missing blobs on demand.
+	AllowAnySHA1InWant bool
+}
+
+// DefaultUploadPackConfig is applied to newly created repositories.
+func DefaultUploadPackConfig() UploadPackConfig {
+	return UploadPackConfig{
+		AllowFilter:        true,
+		AllowAnySHA1InWant: true,
+	}
+}
+
+// ReadUploadPackConfig reads the upload-pack capabilities of the bare
+// repository at repoPath. Unset options read as false, matching git.
+func ReadUploadPackConfig(repoPath string) UploadPackConfig {
+	return UploadPackConfig{
+		AllowFilter:        configBool(repoPath, "uploadpack.allowFilter"),
+		AllowAnySHA1InWant: configBool(repoPath, "uploadpack.allowAnySHA1InWant"),
+	}
+}
+
+// WriteUploadPackConfig stores the upload-pack capabilities in the git
+// config of the bare repository at repoPath.
+func WriteUploadPackConfig(repoPath string, c UploadPackConfig) error {
+	opts := []struct {
+		key   string
+		value bool
+	}{
+		{"uploadpack.allowFilter", c.AllowFilter},
+		{"uploadpack.allowAnySHA1InWant", c.AllowAnySHA1InWant},
+	}
+	for _, o := range opts {
+		cmd := exec.Command("git", "-C", repoPath, "config", "--bool", o.key, strconv.FormatBool(o.value))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git config %s: %w: %s", o.key, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// EnsureUploadPackConfig applies DefaultUploadPackConfig to the bare
+// repository at repoPath if its upload-pack capabilities were never set,
+// as in repositories created before Origin managed them. Capabilities an
+// admin has set, on or off, are left alone.
+func EnsureUploadPackConfig(repoPath string) error {
+	err := exec.Command("git", "-C", repoPath, "config", "--get", "uploadpack.allowFilter").Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		return err // set, or git failed
+	}
+	return WriteUploadPackConfig(repoPath, DefaultUploadPackConfig())
+}
+
+func configBool(repoPath, key string) bool {
+	out, err := exec.Command("git", "-C", repoPath, "config", "--bool", "--get", key).Output()
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(out)) == "true"
+}
+
+// FetchRequest summarizes what a client asked upload-pack for. It is
+// filled in as the request streams through InspectFetch.
+type FetchRequest struct {
+	Wants   int
+	Filter  string // object filter spec, e.g. "blob:none"
+	Shallow bool   // depth-limited history (deepen, deepen-since, ...)
+	Done    bool   // the client ended negotiation
+	// Packfile is set by InspectFetchResponse once upload-pack starts
+	// sending the packfile.
+	Packfile bool
+}
+
+// Served reports whether an exchange of a stateless (HTTP) fetch was its
+// last: negotiation takes a request per round, and only the last one ends
+// it or gets the packfile.
+func (req *FetchRequest) Served() bool {
+	return req.Wants > 0 && (req.Done || req.Packfile)
+}
+
+// InspectFetch wraps the client side of an upload-pack exchange. Reads
+// pass through unchanged while the pkt-lines are decoded into the returned
+// FetchRequest. It understands both protocol v0 want lists and v2 fetch
+// command arguments.
+func InspectFetch(r io.Reader) (io.Reader, *FetchRequest) {
+	req := &FetchRequest{}
+	return &fetchInspector{r: r, req: req}, req
+}
+
+type fetchInspector struct {
+	r      io.Reader
+	req    *FetchRequest
+	buf    []byte
+	broken bool
+}
+
+func (f *fetchInspector) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if n > 0 && !f.broken {
+		f.buf = append(f.buf, p[:n]...)
+		f.parse()
+	}
+	return n, err
+}
+
+func (f *fetchInspector) parse() {
+	for len(f.buf) >= 4 {
+		size, err := strconv.ParseUint(string(f.buf[:4]), 16, 16)
+		if err != nil {
+			// Not pkt-line framed; stop inspecting but keep passing data.
+			f.broken = true
+			f.buf = nil
+			return
+		}
+		if size < 4 {
+			// flush-pkt, delim-pkt or response-end-pkt
+			f.buf = f.buf[4:]
+			continue
+		}
+		if len(f.buf) < int(size) {
+			return
+		}
+		f.line(strings.TrimSuffix(string(f.buf[4:size]), "\n"))
+		f.buf = f.buf[size:]
+	}
+}
+
+func (f *fetchInspector) line(l string) {
+	switch {
+	case strings.HasPrefix(l, "want "):
+		f.req.Wants++
+	case strings.HasPrefix(l, "filter "):
+		f.req.Filter = strings.TrimPrefix(l, "filter ")
+	case strings.HasPrefix(l, "deepen"), strings.HasPrefix(l, "shallow "):
+		f.req.Shallow = true
+	case l == "done":
+		f.req.Done = true
+	}
+}
+
+// InspectFetchResponse wraps the server side of an upload-pack exchange,
+// setting req.Packfile once the packfile starts: the "packfile" section of
+// a protocol v2 response, or side-band pack data or a bare pack in v0.
+// Writes pass through unchanged, and inspection stops there.
+func InspectFetchResponse(w io.Writer, req *FetchRequest) io.Writer {
+	return &responseInspector{w: w, req: req}
+}
+
+type responseInspector struct {
+	w    io.Writer
+	req  *FetchRequest
+	buf  []byte
+	done bool
+}
+
+func (f *responseInspector) Write(p []byte) (int, error) {
+	if !f.done {
+		f.buf = append(f.buf, p...)
+		f.parse()
+	}
+	return f.w.Write(p)
+}
+
+func (f *responseInspector) parse() {
+	for !f.done && len(f.buf) >= 4 {
+		size, err := strconv.ParseUint(string(f.buf[:4]), 16, 16)
+		if err != nil {
+			// Not pkt-line framed: a pack without side-band, or garbage.
+			f.req.Packfile = bytes.HasPrefix(f.buf, []byte("PACK"))
+			f.stop()
+			return
+		}
+		if size < 4 {
+			f.buf = f.buf[4:]
+			continue
+		}
+		if len(f.buf) < int(size) {
+			return
+		}
+		l := string(f.buf[4:size])
+		if strings.TrimSuffix(l, "\n") == "packfile" || l[0] == 1 {
+			f.req.Packfile = true
+			f.stop()
+			return
+		}
+		f.buf = f.buf[size:]
+	}
+}
+
+func (f *responseInspector) stop() {
+	f.done = true
+	f.buf = nil
+}
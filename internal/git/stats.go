@@ -0,0 +1,103 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// FileSize is a file in a tree and its size in bytes.
+type FileSize struct {
+	Path string
+	Size int64
+}
+
+// FileSizes lists the regular and executable files in the tree of commit,
+// leaving out symlinks and submodules.
+func FileSizes(ctx context.Context, repoPath string, commit plumbing.Hash) ([]FileSize, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "ls-tree", "-r", "-l", "-z", commit.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var files []FileSize
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// "<mode> <type> <hash> <size>\t<path>"
+		meta, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		f := strings.Fields(meta)
+		if len(f) != 4 || f[1] != "blob" || f[0] == "120000" {
+			continue
+		}
+		size, _ := strconv.ParseInt(f[3], 10, 64)
+		files = append(files, FileSize{Path: path, Size: size})
+	}
+	return files, nil
+}
+
+// Contributor is an author and how many commits they made.
+type Contributor struct {
+	Name    string
+	Email   string
+	Commits int
+}
+
+// Contributors returns the authors of the history of commit, most commits
+// first. Authors are told apart by name and email, after .mailmap.
+func Contributors(ctx context.Context, repoPath string, commit plumbing.Hash) ([]Contributor, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "shortlog", "-s", "-n", "-e", commit.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git shortlog: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var contributors []Contributor
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		// "<count>\t<name> <<email>>"
+		count, author, ok := strings.Cut(strings.TrimSpace(sc.Text()), "\t")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.Atoi(count)
+		c := Contributor{Name: author, Commits: n}
+		if i := strings.LastIndex(author, " <"); i >= 0 && strings.HasSuffix(author, ">") {
+			c.Name, c.Email = author[:i], author[i+2:len(author)-1]
+		}
+		contributors = append(contributors, c)
+	}
+	return contributors, nil
+}
+
+// CommitDays counts the commits in the history of commit made since since,
+// by the day they were authored in the author's time zone, as YYYY-MM-DD.
+func CommitDays(ctx context.Context, repoPath string, commit plumbing.Hash, since time.Time) (map[string]int, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "log",
+		"--format=%ad", "--date=short", "--since="+strconv.FormatInt(since.Unix(), 10), commit.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	days := make(map[string]int)
+	for _, day := range strings.Fields(string(out)) {
+		days[day]++
+	}
+	return days, nil
+}
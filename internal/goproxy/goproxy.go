@@ -0,0 +1,383 @@
+// Package goproxy serves Go modules straight out of the bare repositories,
+// implementing the read side of the GOPROXY protocol: version lists,
+// .info, .mod and .zip files, built from semver tags and commits.
+//
+// A module path is the server's host, a repository name and optionally a
+// subdirectory and major version suffix, e.g. "git.example.com/tool",
+// "git.example.com/tool/v2" or "git.example.com/mono/cli". Versions of a
+// module in a subdirectory are tagged "{dir}/vX.Y.Z", as the go command
+// expects.
+package goproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	modzip "golang.org/x/mod/zip"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+)
+
+// ErrNotFound is returned for unknown modules, versions and queries.
+var ErrNotFound = errors.New("not found")
+
+// Module is a Go module stored in a repository.
+type Module struct {
+	Path string // module path, e.g. "git.example.com/tool/v2"
+	Repo string // repository name, e.g. "tool"
+	Dir  string // module directory within the repository, "" for the root
+
+	major string // "v2" for a /v2 path, "" for v0 and v1
+}
+
+// Info is the JSON body of a .info or @latest response.
+type Info struct {
+	Version string
+	Time    time.Time
+}
+
+// ParseModulePath splits a module path served by host into the repository
+// and directory holding it.
+func ParseModulePath(host, modPath string) (*Module, error) {
+	if err := module.CheckPath(modPath); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	rest, ok := strings.CutPrefix(modPath, host+"/")
+	if !ok {
+		return nil, fmt.Errorf("%w: module %s is not served by %s", ErrNotFound, modPath, host)
+	}
+
+	prefix, pathMajor, ok := module.SplitPathVersion(rest)
+	if !ok || strings.HasPrefix(pathMajor, ".") {
+		return nil, fmt.Errorf("%w: invalid module path %s", ErrNotFound, modPath)
+	}
+	repo, dir, _ := strings.Cut(prefix, "/")
+
+	return &Module{
+		Path:  modPath,
+		Repo:  repo,
+		Dir:   dir,
+		major: strings.TrimPrefix(pathMajor, "/"),
+	}, nil
+}
+
+// tagPrefix is the prefix of the module's version tags.
+func (m *Module) tagPrefix() string {
+	if m.Dir == "" {
+		return ""
+	}
+	return m.Dir + "/"
+}
+
+// allowsMajor reports whether version v belongs to the module's major
+// version: v0 and v1 for an unsuffixed path, vN for a /vN path.
+func (m *Module) allowsMajor(v string) bool {
+	switch major := semver.Major(v); major {
+	case "v0", "v1":
+		return m.major == ""
+	default:
+		return major == m.major
+	}
+}
+
+// tags returns the module's canonical semver tags and the commits they
+// point at, peeling annotated tags.
+func (m *Module) tags(repo *git.Repository) (map[string]*object.Commit, error) {
+	iter, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+
+	tags := make(map[string]*object.Commit)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		v, ok := strings.CutPrefix(ref.Name().Short(), m.tagPrefix())
+		if !ok || !semver.IsValid(v) || semver.Canonical(v) != v || !m.allowsMajor(v) {
+			return nil
+		}
+		if commit, err := peel(repo, ref.Hash()); err == nil {
+			tags[v] = commit
+		}
+		return nil
+	})
+	return tags, err
+}
+
+// Versions returns the tagged versions of the module, oldest first.
+func (m *Module) Versions(repo *git.Repository) ([]string, error) {
+	tags, err := m.tags(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, 0, len(tags))
+	for v, commit := range tags {
+		// A tag only counts if the module exists at that commit
+		if _, _, err := m.goMod(commit); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	semver.Sort(versions)
+	return versions, nil
+}
+
+// Stat resolves a version or query to an Info. Besides tagged versions and
+// pseudo-versions, query may be a branch, tag or commit hash, which is
+// reported as its tagged version or else as a pseudo-version.
+func (m *Module) Stat(repo *git.Repository, query string) (*Info, error) {
+	if semver.IsValid(query) {
+		commit, err := m.commit(repo, query)
+		if err != nil {
+			return nil, err
+		}
+		return &Info{Version: query, Time: commitTime(commit)}, nil
+	}
+
+	commit, err := gitpkg.ResolveCommit(repo, query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return m.stat(repo, commit)
+}
+
+// Latest returns the highest release version, else the highest
+// pre-release, else a pseudo-version for the tip of the default branch.
+func (m *Module) Latest(repo *git.Repository) (*Info, error) {
+	versions, err := m.Versions(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest string
+	for _, v := range versions {
+		if semver.Prerelease(v) == "" || latest == "" || semver.Prerelease(latest) != "" {
+			latest = v
+		}
+	}
+	if latest != "" {
+		return m.Stat(repo, latest)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("%w: no versions and no default branch", ErrNotFound)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("get commit: %w", err)
+	}
+	return m.stat(repo, commit)
+}
+
+// stat describes commit by the version tagged on it or else by a
+// pseudo-version based on the highest version tagged on an ancestor.
+func (m *Module) stat(repo *git.Repository, commit *object.Commit) (*Info, error) {
+	if _, _, err := m.goMod(commit); err != nil {
+		return nil, err
+	}
+
+	tags, err := m.tags(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagged, base string
+	for v, c := range tags {
+		if c.Hash == commit.Hash {
+			if tagged == "" || semver.Compare(v, tagged) > 0 {
+				tagged = v
+			}
+			continue
+		}
+		if base != "" && semver.Compare(v, base) <= 0 {
+			continue
+		}
+		if ok, err := c.IsAncestor(commit); err == nil && ok {
+			base = v
+		}
+	}
+	if tagged != "" {
+		return &Info{Version: tagged, Time: commitTime(commit)}, nil
+	}
+
+	t := commitTime(commit)
+	rev := commit.Hash.String()[:12]
+	return &Info{Version: module.PseudoVersion(m.major, base, t, rev), Time: t}, nil
+}
+
+// commit returns the commit of a tagged version or pseudo-version.
+func (m *Module) commit(repo *git.Repository, version string) (*object.Commit, error) {
+	if !semver.IsValid(version) || semver.Canonical(version) != version || !m.allowsMajor(version) {
+		return nil, fmt.Errorf("%w: invalid version %s", ErrNotFound, version)
+	}
+
+	if module.IsPseudoVersion(version) {
+		rev, err := module.PseudoVersionRev(version)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+		}
+		commit, err := gitpkg.ResolveCommit(repo, rev)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+		}
+		// The timestamp is part of the version; it must match the commit.
+		if t, err := module.PseudoVersionTime(version); err != nil || !t.Equal(commitTime(commit)) {
+			return nil, fmt.Errorf("%w: %s does not match commit time of %s", ErrNotFound, version, rev)
+		}
+		return commit, nil
+	}
+
+	tags, err := m.tags(repo)
+	if err != nil {
+		return nil, err
+	}
+	commit, ok := tags[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown version %s", ErrNotFound, version)
+	}
+	return commit, nil
+}
+
+// GoMod returns the go.mod file of a version.
+func (m *Module) GoMod(repo *git.Repository, version string) ([]byte, error) {
+	commit, err := m.commit(repo, version)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := m.goMod(commit)
+	return data, err
+}
+
+// goMod finds the module's go.mod at commit and returns it along with the
+// directory it is in. For a /vN module the "major subdirectory" {dir}/vN
+// is tried first. A v0/v1 module without a go.mod gets a synthesized one,
+// as the go command does.
+func (m *Module) goMod(commit *object.Commit) ([]byte, string, error) {
+	var dirs []string
+	if m.major != "" {
+		dirs = append(dirs, path.Join(m.Dir, m.major))
+	}
+	dirs = append(dirs, m.Dir)
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, "", fmt.Errorf("get tree: %w", err)
+	}
+
+	found := false
+	for _, dir := range dirs {
+		f, err := tree.File(path.Join(dir, "go.mod"))
+		if err != nil {
+			continue
+		}
+		found = true
+		data, err := f.Contents()
+		if err != nil {
+			return nil, "", fmt.Errorf("read go.mod: %w", err)
+		}
+		if modfile.ModulePath([]byte(data)) == m.Path {
+			return []byte(data), dir, nil
+		}
+	}
+
+	// A go.mod declaring some other module (e.g. the /v2 of this one)
+	// means this module isn't here.
+	if m.major == "" && !found {
+		if m.Dir == "" {
+			return []byte("module " + m.Path + "\n"), "", nil
+		}
+		if _, err := tree.Tree(m.Dir); err == nil {
+			return []byte("module " + m.Path + "\n"), m.Dir, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%w: no module %s at %s", ErrNotFound, m.Path, commit.Hash.String()[:12])
+}
+
+// Zip writes the module zip of a version: the files under the module's
+// directory, minus anything the go command leaves out (nested modules,
+// vendor directories, symlinks).
+func (m *Module) Zip(w io.Writer, repo *git.Repository, version string) error {
+	commit, err := m.commit(repo, version)
+	if err != nil {
+		return err
+	}
+	_, dir, err := m.goMod(commit)
+	if err != nil {
+		return err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("get tree: %w", err)
+	}
+	if dir != "" {
+		if tree, err = tree.Tree(dir); err != nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, dir)
+		}
+	}
+
+	var files []modzip.File
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files = append(files, zipFile{f})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk tree: %w", err)
+	}
+
+	return modzip.Create(w, module.Version{Path: m.Path, Version: version}, files)
+}
+
+// peel returns the commit that hash, a commit or annotated tag, points at.
+func peel(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	if tag, err := repo.TagObject(hash); err == nil {
+		return tag.Commit()
+	}
+	return repo.CommitObject(hash)
+}
+
+// commitTime is the time the go command uses for a commit, which is the
+// committer time in UTC, to the second.
+func commitTime(c *object.Commit) time.Time {
+	return c.Committer.When.UTC().Truncate(time.Second)
+}
+
+// zipFile adapts a file in a git tree to modzip.File.
+type zipFile struct {
+	f *object.File
+}
+
+func (z zipFile) Path() string { return z.f.Name }
+
+func (z zipFile) Lstat() (fs.FileInfo, error) {
+	mode, err := z.f.Mode.ToOSFileMode()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{name: path.Base(z.f.Name), size: z.f.Size, mode: mode}, nil
+}
+
+func (z zipFile) Open() (io.ReadCloser, error) { return z.f.Reader() }
+
+type fileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi fileInfo) Sys() any           { return nil }
@@ -2,6 +2,8 @@ package hooks
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,10 +13,20 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-git/go-git/v5"
+
+	"github.com/wbrijesh/origin/internal/archive"
+	"github.com/wbrijesh/origin/internal/commitsearch"
+	"github.com/wbrijesh/origin/internal/db"
+	"github.com/wbrijesh/origin/internal/search"
+	"github.com/wbrijesh/origin/internal/stats"
 	"github.com/wbrijesh/origin/internal/webhook"
 )
 
-// RunPostReceive reads ref updates from stdin and triggers webhooks.
+// RunPostReceive reads ref updates from stdin, updates the commit-graph,
+// drops cached archives of the commits that refs moved away from and the
+// repo's cached tree-listing commits, updates the code and commit search
+// indexes and the repo's stats, and triggers webhooks.
 //
 // Environment variables expected:
 //   - ORIGIN_DATA_PATH — path to the data directory
@@ -34,6 +46,61 @@ func RunPostReceive(stdin io.Reader) error {
 	// Update server info for dumb HTTP clients
 	exec.Command("git", "-C", repoPath, "update-server-info").Run() //nolint:errcheck
 
+	// Add the pushed commits to the commit-graph, with changed-path Bloom
+	// filters, so that log pages, ahead/behind counts and path-limited
+	// history don't parse every commit. A split graph only writes the new
+	// commits, merging layers as they pile up.
+	if out, err := exec.Command("git", "-C", repoPath, "commit-graph", "write", "--reachable", "--changed-paths", "--split").CombinedOutput(); err != nil {
+		slog.Error("post-receive: write commit-graph", "error", err, "output", strings.TrimSpace(string(out)))
+	}
+
+	// Parse ref updates: "<old> <new> <ref>" per line
+	var updates [][]string
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 3 {
+			updates = append(updates, parts)
+		}
+	}
+
+	// Archives of a ref are cached by commit; once the ref has moved, the
+	// old commit's archives are no longer what that ref's URL serves.
+	// Annotated tags are peeled to the commit they point at.
+	var moved []string
+	for _, u := range updates {
+		if u[0] == strings.Repeat("0", 40) {
+			continue
+		}
+		out, err := exec.Command("git", "-C", repoPath, "rev-parse", "--verify", "--quiet", u[0]+"^{commit}").Output()
+		if err != nil {
+			continue
+		}
+		moved = append(moved, strings.TrimSpace(string(out)))
+	}
+	if len(moved) > 0 {
+		cache := archive.New(archive.CacheDir(dataPath), 0)
+		if err := cache.InvalidateCommits(repoName, moved); err != nil {
+			slog.Error("post-receive: invalidate archives", "error", err)
+		}
+	}
+
+	if err := invalidateLastCommits(dataPath, repoName); err != nil {
+		slog.Error("post-receive: invalidate last commits", "error", err)
+	}
+
+	// Reindex the default branch for code search while the push's objects
+	// are fresh; searches would otherwise do it on first use.
+	if repo, err := git.PlainOpen(repoPath); err == nil {
+		if err := search.Update(search.IndexDir(dataPath), repoName, repo); err != nil {
+			slog.Error("post-receive: update search index", "error", err)
+		}
+	}
+
+	if err := updateDatabase(dataPath, repoName, repoPath); err != nil {
+		slog.Error("post-receive: update commit index and stats", "error", err)
+	}
+
 	// Load webhooks from DB
 	webhooks, err := loadWebhooks(dataPath, repoName)
 	if err != nil {
@@ -46,21 +113,14 @@ func RunPostReceive(stdin io.Reader) error {
 		return nil
 	}
 
-	// Parse ref updates and fire webhooks
-	scanner := bufio.NewScanner(stdin)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
-		if len(parts) != 3 {
-			continue
-		}
-
+	// Fire webhooks for each ref update
+	for _, u := range updates {
 		event := webhook.PushEvent{
 			Event:     "push",
 			Repo:      repoName,
-			Ref:       parts[2],
-			Before:    parts[0],
-			After:     parts[1],
+			Ref:       u[2],
+			Before:    u[0],
+			After:     u[1],
 			Pusher:    pusherFP,
 			Timestamp: time.Now().UTC().Format(time.RFC3339),
 		}
@@ -71,6 +131,38 @@ func RunPostReceive(stdin io.Reader) error {
 	return nil
 }
 
+// invalidateLastCommits drops the last-commit answers cached for a repo's
+// tree listings.
+func invalidateLastCommits(dataPath, repoName string) error {
+	dbPath := filepath.Join(dataPath, "origin.db")
+	query := fmt.Sprintf(
+		"DELETE FROM dir_last_commits WHERE repo_id IN (SELECT id FROM repositories WHERE name = '%s');",
+		strings.ReplaceAll(repoName, "'", "''"),
+	)
+
+	if out, err := exec.Command("sqlite3", dbPath, query).CombinedOutput(); err != nil {
+		return fmt.Errorf("delete last commits: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// updateDatabase adds the pushed commits to the commit search index and
+// recomputes the repo's stats. Unlike the other queries here it goes
+// through the database driver, as the first index of a large repository
+// inserts too many rows to pass to the sqlite3 CLI.
+func updateDatabase(dataPath, repoName, repoPath string) error {
+	database, err := db.Open(filepath.Join(dataPath, "origin.db"))
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	ctx := context.Background()
+	return errors.Join(
+		commitsearch.New(database).Update(ctx, repoName, repoPath),
+		stats.New(database).Update(ctx, repoName, repoPath),
+	)
+}
+
 // loadWebhooks queries the database for active webhooks for a repo.
 func loadWebhooks(dataPath, repoName string) ([]webhook.Webhook, error) {
 	dbPath := filepath.Join(dataPath, "origin.db")
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+)
+
+// maxHighlightDiffLines is the largest file diff, in lines, that gets
+// syntax highlighting; bigger ones are shown as plain text.
+const maxHighlightDiffLines = 5000
+
+// diffFile is a file diff prepared for the commit and compare pages.
+type diffFile struct {
+	*gitpkg.FileDiff
+	Anchor string
+	Hunks  []diffHunk
+}
+
+// diffHunk holds a hunk's lines for the unified view and the same lines
+// paired up for the split view.
+type diffHunk struct {
+	Header string
+	Lines  []diffLine
+	Rows   []diffRow
+}
+
+// diffLine is a hunk line with its text highlighted.
+type diffLine struct {
+	Op      string
+	Prefix  string
+	OldLine int
+	NewLine int
+	HTML    template.HTML
+}
+
+// diffRow is a row of the split view; either side may be empty.
+type diffRow struct {
+	Old *diffLine
+	New *diffLine
+}
+
+// diffView returns the diff layout chosen with ?view=, "unified" by default.
+func diffView(r *http.Request) string {
+	if r.URL.Query().Get("view") == "split" {
+		return "split"
+	}
+	return "unified"
+}
+
+// prepareDiff highlights each file of a diff and lays it out for viewing.
+func prepareDiff(diff *gitpkg.DiffResult) []diffFile {
+	files := make([]diffFile, len(diff.Files))
+	for i := range diff.Files {
+		fd := &diff.Files[i]
+		files[i] = diffFile{
+			FileDiff: fd,
+			Anchor:   fmt.Sprintf("diff-%d", i),
+			Hunks:    highlightHunks(fd),
+		}
+	}
+	return files
+}
+
+// highlightHunks highlights a file's hunks. The old and new sides are each
+// tokenised as one text, so constructs spanning lines highlight correctly
+// within a hunk.
+func highlightHunks(fd *gitpkg.FileDiff) []diffHunk {
+	var oldText, newText strings.Builder
+	oldCount, newCount := 0, 0
+	for _, h := range fd.Hunks {
+		for _, l := range h.Lines {
+			if l.Op != "+" {
+				oldText.WriteString(l.Text + "\n")
+				oldCount++
+			}
+			if l.Op != "-" {
+				newText.WriteString(l.Text + "\n")
+				newCount++
+			}
+		}
+	}
+
+	var oldLines, newLines []template.HTML
+	if oldCount+newCount <= maxHighlightDiffLines {
+		if lexer := lexers.Match(filepath.Base(fd.Name())); lexer != nil {
+			lexer = chroma.Coalesce(lexer)
+			oldLines = highlightLines(lexer, oldText.String(), oldCount)
+			newLines = highlightLines(lexer, newText.String(), newCount)
+		}
+	}
+
+	line := func(lines []template.HTML, i int, text string) template.HTML {
+		if i < len(lines) {
+			return lines[i]
+		}
+		return template.HTML(template.HTMLEscapeString(text)) //nolint:gosec
+	}
+
+	hunks := make([]diffHunk, len(fd.Hunks))
+	oi, ni := 0, 0
+	for i, h := range fd.Hunks {
+		dh := diffHunk{Header: h.Header, Lines: make([]diffLine, len(h.Lines))}
+		for j, l := range h.Lines {
+			dl := diffLine{Op: l.Op, Prefix: l.Prefix, OldLine: l.OldLine, NewLine: l.NewLine}
+			switch l.Op {
+			case "+":
+				dl.HTML = line(newLines, ni, l.Text)
+				ni++
+			case "-":
+				dl.HTML = line(oldLines, oi, l.Text)
+				oi++
+			default:
+				dl.HTML = line(newLines, ni, l.Text)
+				oi++
+				ni++
+			}
+			dh.Lines[j] = dl
+		}
+		dh.Rows = splitRows(dh.Lines)
+		hunks[i] = dh
+	}
+	return hunks
+}
+
+// splitRows pairs a hunk's lines for the split view: context lines sit on
+// both sides, and each run of deletions is matched line by line with the
+// additions that follow it.
+func splitRows(lines []diffLine) []diffRow {
+	var rows []diffRow
+	for i := 0; i < len(lines); {
+		if lines[i].Op == " " {
+			rows = append(rows, diffRow{Old: &lines[i], New: &lines[i]})
+			i++
+			continue
+		}
+		var dels, adds []*diffLine
+		for ; i < len(lines) && lines[i].Op == "-"; i++ {
+			dels = append(dels, &lines[i])
+		}
+		for ; i < len(lines) && lines[i].Op == "+"; i++ {
+			adds = append(adds, &lines[i])
+		}
+		for k := 0; k < max(len(dels), len(adds)); k++ {
+			var row diffRow
+			if k < len(dels) {
+				row.Old = dels[k]
+			}
+			if k < len(adds) {
+				row.New = adds[k]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// highlightLines tokenises text and returns the HTML of each of its n
+// lines, using the same chroma classes as highlightCode. It returns nil if
+// the lexer fails or loses lines.
+func highlightLines(lexer chroma.Lexer, text string, n int) []template.HTML {
+	iterator, err := lexer.Tokenise(nil, text)
+	if err != nil {
+		return nil
+	}
+	var lines []template.HTML
+	for _, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		var b strings.Builder
+		for _, t := range tokens {
+			value := template.HTMLEscapeString(strings.TrimSuffix(t.Value, "\n"))
+			if value == "" {
+				continue
+			}
+			if class := tokenClass(t.Type); class != "" {
+				fmt.Fprintf(&b, `<span class="%s">%s</span>`, class, value)
+			} else {
+				b.WriteString(value)
+			}
+		}
+		lines = append(lines, template.HTML(b.String())) //nolint:gosec
+	}
+	if len(lines) < n {
+		return nil
+	}
+	return lines
+}
+
+// tokenClass returns the chroma CSS class for a token type, falling back
+// to its sub-category and category as chroma's HTML formatter does.
+func tokenClass(t chroma.TokenType) string {
+	for _, tt := range []chroma.TokenType{t, t.SubCategory(), t.Category()} {
+		if class := chroma.StandardTypes[tt]; class != "" {
+			return class
+		}
+	}
+	return ""
+}
@@ -0,0 +1,417 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wbrijesh/origin/internal/db"
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+	"github.com/wbrijesh/origin/internal/release"
+)
+
+// The JSON API lives under /-/api/ and is meant for CI. Requests
+// authenticate with an access token (see hasValidToken); reads of public
+// repositories work without one.
+
+// requireToken is a middleware that rejects API requests without a valid
+// access token.
+func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.hasValidToken(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="origin"`)
+			writeJSONError(w, http.StatusUnauthorized, "a valid access token is required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// commitJSON is a commit as returned by the API.
+type commitJSON struct {
+	Hash        string    `json:"hash"`
+	Parents     []string  `json:"parents"`
+	Author      string    `json:"author"`
+	AuthorEmail string    `json:"author_email"`
+	Date        time.Time `json:"date"`
+	Message     string    `json:"message"`
+	URL         string    `json:"url"`
+}
+
+// commitPageJSON is a page of commits. Next is the after parameter for
+// the following page, if there is one.
+type commitPageJSON struct {
+	Commits []commitJSON `json:"commits"`
+	Next    *string      `json:"next"`
+}
+
+func (s *Server) commitPage(repoName string, commits []gitpkg.CommitInfo, info gitpkg.PageInfo) commitPageJSON {
+	out := commitPageJSON{Commits: s.commitsToJSON(repoName, commits)}
+	if info.Next != "" {
+		out.Next = &info.Next
+	}
+	return out
+}
+
+func (s *Server) commitsToJSON(repoName string, commits []gitpkg.CommitInfo) []commitJSON {
+	out := make([]commitJSON, 0, len(commits))
+	for _, c := range commits {
+		parents := c.Parents
+		if parents == nil {
+			parents = []string{}
+		}
+		out = append(out, commitJSON{
+			Hash:        c.Hash,
+			Parents:     parents,
+			Author:      c.Author,
+			AuthorEmail: c.AuthorEmail,
+			Date:        c.Date.UTC(),
+			Message:     c.Message,
+			URL:         s.cfg.HTTP.PublicURL + "/" + repoName + "/commit/" + c.Hash,
+		})
+	}
+	return out
+}
+
+// apiListCommits lists the history of a ref (the default branch if not
+// given), or of a path in it with path, a page at a time.
+func (s *Server) apiListCommits(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+	ref := r.URL.Query().Get("ref")
+	if ref == "" {
+		ref = gitpkg.DefaultBranch(gitRepo)
+	}
+	commit, err := gitpkg.ResolveCommit(gitRepo, ref)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "ref not found")
+		return
+	}
+
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	page := gitpkg.Page{After: r.URL.Query().Get("after"), Size: 30}
+	var commits []gitpkg.CommitInfo
+	var info gitpkg.PageInfo
+	if path := strings.Trim(r.URL.Query().Get("path"), "/"); path != "" {
+		var fileCommits []gitpkg.FileCommit
+		fileCommits, info, err = gitpkg.FileLog(r.Context(), repoPath, commit.Hash, path, page)
+		for _, c := range fileCommits {
+			commits = append(commits, c.CommitInfo)
+		}
+	} else {
+		commits, info, err = gitpkg.Log(r.Context(), repoPath, commit.Hash, page)
+	}
+	if errors.Is(err, gitpkg.ErrUnknownRevision) || errors.Is(err, gitpkg.ErrInvalidRevision) {
+		writeJSONError(w, http.StatusBadRequest, "after is not a cursor of this history")
+		return
+	}
+	if err != nil {
+		slog.Error("api: list commits", "repo", repoName, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list commits")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.commitPage(repoName, commits, info))
+}
+
+// apiSearchCommits searches a repository's commits; it takes the same
+// parameters as the web search page.
+func (s *Server) apiSearchCommits(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	q, err := parseCommitQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.IsZero() {
+		writeJSONError(w, http.StatusBadRequest, "give at least one of q, author, committer, since, until or path")
+		return
+	}
+
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	page := gitpkg.Page{After: r.URL.Query().Get("after"), Size: 30}
+	commits, info, err := s.commits.Search(r.Context(), repoName, repoPath, q, page)
+	if errors.Is(err, gitpkg.ErrUnknownRevision) {
+		writeJSONError(w, http.StatusBadRequest, "after is not a commit of this repository")
+		return
+	}
+	if err != nil {
+		slog.Error("api: search commits", "repo", repoName, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to search commits")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.commitPage(repoName, commits, info))
+}
+
+// releaseJSON is a release as returned by the API, with download URLs.
+type releaseJSON struct {
+	release.Release
+	URL    string      `json:"url"`
+	Assets []assetJSON `json:"assets"`
+}
+
+type assetJSON struct {
+	release.Asset
+	DownloadURL string `json:"download_url"`
+}
+
+func (s *Server) releaseToJSON(repoName string, rel *release.Release) releaseJSON {
+	out := releaseJSON{
+		Release: *rel,
+		URL:     s.cfg.HTTP.PublicURL + releaseURL(repoName, rel.Tag),
+		Assets:  []assetJSON{},
+	}
+	for _, a := range rel.Assets {
+		out.Assets = append(out.Assets, assetJSON{
+			Asset:       a,
+			DownloadURL: s.cfg.HTTP.PublicURL + assetURL(repoName, rel.Tag, a.Name),
+		})
+	}
+	return out
+}
+
+func (s *Server) apiListReleases(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	releases, err := s.releases.List(repoName, s.hasValidToken(r))
+	if err != nil {
+		slog.Error("api: list releases", "repo", repoName, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list releases")
+		return
+	}
+
+	out := make([]releaseJSON, 0, len(releases))
+	for i := range releases {
+		out = append(out, s.releaseToJSON(repoName, &releases[i]))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) apiGetRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	// Served both for /releases/tags/{tag} and for /releases/latest
+	var rel *release.Release
+	var err error
+	if tag := r.PathValue("tag"); tag != "" {
+		rel, err = s.releases.Get(repoName, tag)
+	} else {
+		rel, err = s.releases.Latest(repoName)
+	}
+	if err != nil || (rel.IsDraft && !s.hasValidToken(r)) {
+		writeJSONError(w, http.StatusNotFound, "release not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.releaseToJSON(repoName, rel))
+}
+
+// releaseRequest is the body of create and update requests. Fields left
+// out of an update keep their value.
+type releaseRequest struct {
+	Tag        string  `json:"tag"`
+	Title      *string `json:"title"`
+	Notes      *string `json:"notes"`
+	Draft      *bool   `json:"draft"`
+	Prerelease *bool   `json:"prerelease"`
+}
+
+func (req *releaseRequest) apply(rel *release.Release) {
+	if req.Title != nil {
+		rel.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Notes != nil {
+		rel.Notes = *req.Notes
+	}
+	if req.Draft != nil {
+		rel.IsDraft = *req.Draft
+	}
+	if req.Prerelease != nil {
+		rel.IsPrerelease = *req.Prerelease
+	}
+}
+
+func (s *Server) apiCreateRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !db.CanReadRepo(s.db, repoName, true) {
+		writeJSONError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	var req releaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Tag) == "" {
+		writeJSONError(w, http.StatusBadRequest, "body must be JSON with a \"tag\"")
+		return
+	}
+
+	rel := &release.Release{Tag: strings.TrimSpace(req.Tag)}
+	req.apply(rel)
+
+	if err := s.releases.Create(repoName, rel); err != nil {
+		switch {
+		case errors.Is(err, release.ErrNoTag):
+			writeJSONError(w, http.StatusUnprocessableEntity, "tag does not exist: "+rel.Tag)
+		case errors.Is(err, release.ErrExists):
+			writeJSONError(w, http.StatusConflict, "release already exists: "+rel.Tag)
+		default:
+			slog.Error("api: create release", "repo", repoName, "tag", rel.Tag, "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to create release")
+		}
+		return
+	}
+
+	rel, _ = s.releases.GetByID(repoName, rel.ID)
+	writeJSON(w, http.StatusCreated, s.releaseToJSON(repoName, rel))
+}
+
+func (s *Server) apiUpdateRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel, err := s.releaseFromPath(repoName, r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "release not found")
+		return
+	}
+
+	var req releaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body must be JSON")
+		return
+	}
+	req.apply(rel)
+
+	if err := s.releases.Update(rel); err != nil {
+		slog.Error("api: update release", "repo", repoName, "tag", rel.Tag, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to update release")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.releaseToJSON(repoName, rel))
+}
+
+func (s *Server) apiDeleteRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel, err := s.releaseFromPath(repoName, r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "release not found")
+		return
+	}
+
+	if err := s.releases.Delete(rel); err != nil {
+		slog.Error("api: delete release", "repo", repoName, "tag", rel.Tag, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to delete release")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiUploadReleaseAsset stores the raw request body as an asset named by
+// the "name" query parameter, e.g.
+//
+//	curl -H "Authorization: Bearer $TOKEN" --data-binary @tool.tar.gz \
+//	     "$ORIGIN/-/api/repos/tool/releases/3/assets?name=tool.tar.gz"
+func (s *Server) apiUploadReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel, err := s.releaseFromPath(repoName, r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "release not found")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "application/x-www-form-urlencoded" {
+		// curl's default for --data-binary; not a real content type here
+		contentType = ""
+	}
+
+	asset, err := s.releases.AddAsset(rel, name, contentType, r.Body, s.cfg.Releases.MaxAssetMB<<20)
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, release.ErrInvalidName):
+			code = http.StatusBadRequest
+		case errors.Is(err, release.ErrExists):
+			code = http.StatusConflict
+		case errors.Is(err, release.ErrTooLarge):
+			code = http.StatusRequestEntityTooLarge
+		}
+		writeJSONError(w, code, assetErrorMessage(err, name, s.cfg.Releases.MaxAssetMB))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, assetJSON{
+		Asset:       *asset,
+		DownloadURL: s.cfg.HTTP.PublicURL + assetURL(repoName, rel.Tag, asset.Name),
+	})
+}
+
+func (s *Server) apiDeleteReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel, err := s.releaseFromPath(repoName, r)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "release not found")
+		return
+	}
+	asset, err := rel.FindAsset(r.PathValue("name"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "asset not found")
+		return
+	}
+
+	if err := s.releases.DeleteAsset(asset); err != nil {
+		slog.Error("api: delete asset", "repo", repoName, "asset", asset.Name, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to delete asset")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v) //nolint:errcheck
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]any{"error": message, "status": code})
+}
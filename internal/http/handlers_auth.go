@@ -160,6 +160,34 @@ func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// hasValidToken reports whether the request carries an unexpired access
+// token, either as "Authorization: Bearer <token>" or as the password of
+// HTTP Basic auth (the username is ignored), which is what git and netrc
+// send.
+func (s *Server) hasValidToken(r *http.Request) bool {
+	token := ""
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	} else if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	}
+	return s.isValidToken(token)
+}
+
+// isValidToken reports whether token is an unexpired access token.
+func (s *Server) isValidToken(token string) bool {
+	if token == "" {
+		return false
+	}
+
+	var count int
+	err := s.db.Get(&count,
+		"SELECT COUNT(*) FROM access_tokens WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)",
+		sha256Hash(token),
+	)
+	return err == nil && count > 0
+}
+
 // --- SSH Key Management ---
 
 func (s *Server) handleAddSSHKey(w http.ResponseWriter, r *http.Request) {
@@ -296,6 +324,11 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Enable partial clone and on-demand object fetches
+	if err := gitpkg.WriteUploadPackConfig(repoPath, gitpkg.DefaultUploadPackConfig()); err != nil {
+		slog.Error("configure upload-pack failed", "error", err)
+	}
+
 	// Generate hooks
 	originBin, _ := os.Executable()
 	if err := hooks.GenerateHooks(repoPath, originBin); err != nil {
@@ -348,6 +381,8 @@ func (s *Server) handleRepoSettings(w http.ResponseWriter, r *http.Request) {
 		data["DefaultBranch"] = gitpkg.DefaultBranch(gitRepo)
 	}
 
+	data["UploadPack"] = gitpkg.ReadUploadPackConfig(filepath.Join(s.cfg.ReposPath(), repoName+".git"))
+
 	// Load webhooks
 	type webhookRow struct {
 		ID     int    `db:"id"`
@@ -377,12 +412,21 @@ func (s *Server) handleUpdateRepoSettings(w http.ResponseWriter, r *http.Request
 		description, privateInt, repoName,
 	) //nolint:errcheck
 
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+
 	// Update HEAD if default branch changed
 	if defaultBranch != "" {
-		repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
 		exec.Command("git", "-C", repoPath, "symbolic-ref", "HEAD", "refs/heads/"+defaultBranch).Run() //nolint:errcheck
 	}
 
+	uploadPack := gitpkg.UploadPackConfig{
+		AllowFilter:        r.FormValue("allow_filter") == "on",
+		AllowAnySHA1InWant: r.FormValue("allow_any_sha1") == "on",
+	}
+	if err := gitpkg.WriteUploadPackConfig(repoPath, uploadPack); err != nil {
+		slog.Error("update upload-pack config", "repo", repoName, "error", err)
+	}
+
 	http.Redirect(w, r, "/"+repoName+"/-/settings", http.StatusSeeOther)
 }
 
@@ -406,17 +450,37 @@ func (s *Server) handleRenameRepo(w http.ResponseWriter, r *http.Request) {
 
 	s.db.Exec("UPDATE repositories SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE name = ?", newName, repoName) //nolint:errcheck
 
+	if err := s.archives.RenameRepo(repoName, newName); err != nil {
+		slog.Error("clear archive cache", "repo", repoName, "error", err)
+	}
+	if err := s.searcher.RemoveRepo(repoName); err != nil {
+		slog.Error("remove search index", "repo", repoName, "error", err)
+	}
+
 	http.Redirect(w, r, "/"+newName+"/-/settings", http.StatusSeeOther)
 }
 
 func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
 	repoName := sanitizeRepoPath(r.PathValue("repo"))
 
+	// Asset files are found through the release rows, so remove them
+	// before the repository row (and its releases) are deleted.
+	if err := s.releases.RemoveRepo(repoName); err != nil {
+		slog.Error("remove release assets", "repo", repoName, "error", err)
+	}
+
 	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
 	os.RemoveAll(repoPath)
 
 	s.db.Exec("DELETE FROM repositories WHERE name = ?", repoName) //nolint:errcheck
 
+	if err := s.archives.RemoveRepo(repoName); err != nil {
+		slog.Error("clear archive cache", "repo", repoName, "error", err)
+	}
+	if err := s.searcher.RemoveRepo(repoName); err != nil {
+		slog.Error("remove search index", "repo", repoName, "error", err)
+	}
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -483,6 +547,25 @@ func (s *Server) handleSettingsWithNewToken(w http.ResponseWriter, r *http.Reque
 		data["NewToken"] = newToken
 	}
 
+	// Partial clone status: per-repo capabilities and what has been served
+	type fetchStatsRow struct {
+		Name            string     `db:"name"`
+		Fetches         int        `db:"fetches"`
+		FilteredFetches int        `db:"filtered_fetches"`
+		ShallowFetches  int        `db:"shallow_fetches"`
+		LastFilter      string     `db:"last_filter"`
+		LastFilteredAt  *time.Time `db:"last_filtered_at"`
+		UploadPack      gitpkg.UploadPackConfig
+	}
+	var fetchStats []fetchStatsRow
+	s.db.Select(&fetchStats, `SELECT r.name, COALESCE(f.fetches, 0) AS fetches, COALESCE(f.filtered_fetches, 0) AS filtered_fetches,
+		COALESCE(f.shallow_fetches, 0) AS shallow_fetches, COALESCE(f.last_filter, '') AS last_filter, f.last_filtered_at
+		FROM repositories r LEFT JOIN fetch_stats f ON f.repo_id = r.id ORDER BY r.name`) //nolint:errcheck
+	for i := range fetchStats {
+		fetchStats[i].UploadPack = gitpkg.ReadUploadPackConfig(filepath.Join(s.cfg.ReposPath(), fetchStats[i].Name+".git"))
+	}
+	data["FetchStats"] = fetchStats
+
 	s.render.render(w, "settings", data)
 }
 
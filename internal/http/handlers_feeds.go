@@ -0,0 +1,328 @@
+package http
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wbrijesh/origin/internal/db"
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+	"github.com/wbrijesh/origin/internal/release"
+)
+
+// Atom feeds of a ref's commits, a repository's tags and recent commits
+// across the server. Feed readers often can't send headers, so besides
+// the usual session and Authorization header, feeds of private repos can
+// be read with an access token in the URL as ?token=.
+
+// feedEntries is how many entries a feed lists.
+const feedEntries = 30
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  atomPerson `xml:"author"`
+	Link    atomLink   `xml:"link"`
+	Content *atomText  `xml:"content,omitempty"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// feedLink is a feed advertised for auto-discovery by layout.html.
+type feedLink struct {
+	Title string
+	URL   string
+}
+
+// atomTime formats a time as Atom requires.
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// hasFeedAuth reports whether the request may read private feeds.
+func (s *Server) hasFeedAuth(r *http.Request) bool {
+	return s.isLoggedIn(r) || s.hasValidToken(r) || s.isValidToken(r.URL.Query().Get("token"))
+}
+
+// canAccessFeed is canAccessRepo for feeds.
+func (s *Server) canAccessFeed(name string, r *http.Request) bool {
+	return db.CanReadRepo(s.db, name, s.hasFeedAuth(r))
+}
+
+// writeFeed writes feed with self as its ID and self link; self is a
+// path, without the token a reader may have used.
+func (s *Server) writeFeed(w http.ResponseWriter, feed *atomFeed, self, alternate string) {
+	feed.ID = s.cfg.HTTP.PublicURL + self
+	feed.Links = []atomLink{
+		{Rel: "self", Type: "application/atom+xml", Href: s.cfg.HTTP.PublicURL + self},
+		{Rel: "alternate", Type: "text/html", Href: s.cfg.HTTP.PublicURL + alternate},
+	}
+	feed.Updated = atomTime(time.Now())
+	if len(feed.Entries) > 0 {
+		feed.Updated = ""
+		for _, e := range feed.Entries {
+			feed.Updated = max(feed.Updated, e.Updated) // all in UTC, so they sort as strings
+		}
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		slog.Error("marshal feed", "feed", self, "error", err)
+		http.Error(w, "failed to build feed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header)) //nolint:errcheck
+	w.Write(out)                //nolint:errcheck
+}
+
+// commitEntry is the feed entry of a commit. The title is prefixed with
+// prefix, if any.
+func (s *Server) commitEntry(repoName string, c gitpkg.CommitInfo, prefix string) atomEntry {
+	url := s.cfg.HTTP.PublicURL + "/" + repoName + "/commit/" + c.Hash
+	return atomEntry{
+		ID:      url,
+		Title:   prefix + firstLine(c.Message),
+		Updated: atomTime(c.Date),
+		Author:  atomPerson{Name: c.Author, Email: c.AuthorEmail},
+		Link:    atomLink{Href: url},
+		Content: &atomText{Type: "text", Body: c.Message},
+	}
+}
+
+// logFeedRef reports whether the refpath of /{repo}/log/{refpath} asks
+// for the feed of a ref: it ends in ".atom" and the whole of it before
+// that resolves as a ref. Anything else is the history of a path, which
+// may well end in ".atom" itself.
+func (s *Server) logFeedRef(repoName, refPath string) (string, bool) {
+	ref, ok := strings.CutSuffix(refPath, ".atom")
+	if !ok {
+		return "", false
+	}
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		return "", false
+	}
+	if _, err := gitpkg.ResolveCommit(gitRepo, ref); err != nil {
+		return "", false
+	}
+	return ref, true
+}
+
+// handleLogFeed serves /{repo}/log/{ref}.atom, the commits of a ref.
+func (s *Server) handleLogFeed(w http.ResponseWriter, r *http.Request, ref string) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessFeed(repoName, r) {
+		http.Error(w, "repository not found", http.StatusNotFound)
+		return
+	}
+
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		http.Error(w, "failed to open repository", http.StatusInternalServerError)
+		return
+	}
+	commit, err := gitpkg.ResolveCommit(gitRepo, ref)
+	if err != nil {
+		http.Error(w, "ref not found", http.StatusNotFound)
+		return
+	}
+
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	commits, _, err := gitpkg.Log(r.Context(), repoPath, commit.Hash, gitpkg.Page{Size: feedEntries})
+	if err != nil {
+		slog.Error("feed: log", "repo", repoName, "ref", ref, "error", err)
+		http.Error(w, "failed to list commits", http.StatusInternalServerError)
+		return
+	}
+
+	feed := &atomFeed{Title: fmt.Sprintf("%s commits on %s", repoName, ref)}
+	for _, c := range commits {
+		feed.Entries = append(feed.Entries, s.commitEntry(repoName, c, ""))
+	}
+	s.writeFeed(w, feed, "/"+repoName+"/log/"+ref+".atom", "/"+repoName+"/log/"+ref)
+}
+
+// handleTagsFeed serves /{repo}/tags.atom. Tags with a published release
+// link to it and carry its notes.
+func (s *Server) handleTagsFeed(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessFeed(repoName, r) {
+		http.Error(w, "repository not found", http.StatusNotFound)
+		return
+	}
+
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		http.Error(w, "failed to open repository", http.StatusInternalServerError)
+		return
+	}
+	tags, err := gitpkg.ListTags(gitRepo)
+	if err != nil {
+		slog.Error("feed: list tags", "repo", repoName, "error", err)
+		http.Error(w, "failed to list tags", http.StatusInternalServerError)
+		return
+	}
+	if len(tags) > feedEntries {
+		tags = tags[:feedEntries]
+	}
+
+	releases, err := s.releases.List(repoName, false)
+	if err != nil {
+		slog.Error("feed: list releases", "repo", repoName, "error", err)
+	}
+
+	feed := &atomFeed{Title: repoName + " tags"}
+	for _, tag := range tags {
+		link := s.cfg.HTTP.PublicURL + "/" + repoName + "/tree/" + url.PathEscape(tag.Name)
+		entry := atomEntry{
+			ID:      link,
+			Title:   tag.Name,
+			Updated: atomTime(tag.Date),
+			Author:  atomPerson{Name: tag.Tagger, Email: tag.TaggerEmail},
+			Link:    atomLink{Href: link},
+		}
+		if tag.Message != "" {
+			entry.Content = &atomText{Type: "text", Body: tag.Message}
+		}
+		if i := slices.IndexFunc(releases, func(rel release.Release) bool { return rel.Tag == tag.Name }); i >= 0 {
+			rel := &releases[i]
+			entry.Title = rel.DisplayTitle()
+			entry.Link.Href = s.cfg.HTTP.PublicURL + releaseURL(repoName, tag.Name)
+			if rel.Notes != "" {
+				entry.Content = &atomText{Type: "html", Body: string(s.render.renderMarkdown(rel.Notes))}
+			}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	s.writeFeed(w, feed, "/"+repoName+"/tags.atom", "/"+repoName+"/refs")
+}
+
+// handleActivityFeed serves /-/activity.atom, the latest commits on the
+// default branch of every repository the reader can see.
+func (s *Server) handleActivityFeed(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT name FROM repositories WHERE is_private = 0 ORDER BY name"
+	if s.hasFeedAuth(r) {
+		query = "SELECT name FROM repositories ORDER BY name"
+	}
+	var names []string
+	if err := s.db.Select(&names, query); err != nil {
+		slog.Error("feed: query repos", "error", err)
+		http.Error(w, "failed to list repositories", http.StatusInternalServerError)
+		return
+	}
+
+	type repoCommit struct {
+		repo   string
+		commit gitpkg.CommitInfo
+	}
+	var all []repoCommit
+	for _, name := range names {
+		gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), name)
+		if err != nil {
+			continue
+		}
+		commit, err := gitpkg.ResolveCommit(gitRepo, gitpkg.DefaultBranch(gitRepo))
+		if err != nil {
+			continue // empty repository
+		}
+		commits, ok := s.activity.get(name, commit.Hash.String())
+		if !ok {
+			commits, _, err = gitpkg.Log(r.Context(), filepath.Join(s.cfg.ReposPath(), name+".git"), commit.Hash, gitpkg.Page{Size: feedEntries})
+			if err != nil {
+				slog.Error("feed: log", "repo", name, "error", err)
+				continue
+			}
+			s.activity.put(name, commit.Hash.String(), commits)
+		}
+		for _, c := range commits {
+			all = append(all, repoCommit{name, c})
+		}
+	}
+	slices.SortStableFunc(all, func(a, b repoCommit) int { return b.commit.Date.Compare(a.commit.Date) })
+	if len(all) > feedEntries {
+		all = all[:feedEntries]
+	}
+
+	feed := &atomFeed{Title: s.cfg.Name + " activity"}
+	for _, rc := range all {
+		feed.Entries = append(feed.Entries, s.commitEntry(rc.repo, rc.commit, rc.repo+": "))
+	}
+	s.writeFeed(w, feed, "/-/activity.atom", "/")
+}
+
+// activityCache holds the newest commits of each repository's default
+// branch for the activity feed, with the commit the branch pointed at.
+// Branches only move when pushed to, so a repository costs a git process
+// once per push instead of on every fetch of the feed.
+type activityCache struct {
+	mu    sync.Mutex
+	repos map[string]activityCommits
+}
+
+type activityCommits struct {
+	tip     string
+	commits []gitpkg.CommitInfo
+}
+
+// get returns the commits cached for repoName if its branch is still at tip.
+func (c *activityCache) get(repoName, tip string) ([]gitpkg.CommitInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.repos[repoName]
+	if !ok || e.tip != tip {
+		return nil, false
+	}
+	return e.commits, true
+}
+
+func (c *activityCache) put(repoName, tip string, commits []gitpkg.CommitInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.repos == nil {
+		c.repos = make(map[string]activityCommits)
+	}
+	c.repos[repoName] = activityCommits{tip, commits}
+}
+
+// repoFeeds are the feeds advertised on a repository's pages: the
+// commits of ref and the tags.
+func repoFeeds(repoName, ref string) []feedLink {
+	return []feedLink{
+		{Title: fmt.Sprintf("%s commits on %s", repoName, ref), URL: "/" + repoName + "/log/" + ref + ".atom"},
+		{Title: repoName + " tags", URL: "/" + repoName + "/tags.atom"},
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/wbrijesh/origin/internal/db"
 	gitpkg "github.com/wbrijesh/origin/internal/git"
 )
 
@@ -29,25 +30,31 @@ func (s *Server) gitInfoRefs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if repo exists and is accessible
-	if !s.canReadRepo(repoName) {
-		renderStatus(w, http.StatusNotFound)
+	if !s.canReadRepo(repoName, r) {
+		denyGitRead(w, r)
 		return
 	}
 
 	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	protocol := gitpkg.SanitizeProtocol(r.Header.Get("Git-Protocol"))
 
 	w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
 	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Git-Protocol")
 	w.WriteHeader(http.StatusOK)
 
-	// Write pktline service header
-	gitpkg.WritePktline(w, "# service=git-upload-pack") //nolint:errcheck
+	// Write pktline service header. Protocol v2 clients expect the
+	// capability advertisement to start immediately, as git-http-backend does.
+	if !gitpkg.IsProtocolV2(protocol) {
+		gitpkg.WritePktline(w, "# service=git-upload-pack") //nolint:errcheck
+	}
 
 	// Run git upload-pack --stateless-rpc --advertise-refs
 	cmd := gitpkg.ServiceCommand{
-		Dir:    repoPath,
-		Args:   []string{"--stateless-rpc", "--advertise-refs"},
-		Stdout: w,
+		Dir:      repoPath,
+		Args:     []string{"--stateless-rpc", "--advertise-refs"},
+		Protocol: protocol,
+		Stdout:   w,
 	}
 
 	if err := gitpkg.UploadPackService.Run(r.Context(), cmd); err != nil {
@@ -61,8 +68,8 @@ func (s *Server) gitInfoRefs(w http.ResponseWriter, r *http.Request) {
 func (s *Server) gitUploadPack(w http.ResponseWriter, r *http.Request) {
 	repoName := sanitizeRepoPath(r.PathValue("repo"))
 
-	if !s.canReadRepo(repoName) {
-		renderStatus(w, http.StatusNotFound)
+	if !s.canReadRepo(repoName, r) {
+		denyGitRead(w, r)
 		return
 	}
 
@@ -86,17 +93,28 @@ func (s *Server) gitUploadPack(w http.ResponseWriter, r *http.Request) {
 		reader = gz
 	}
 
+	stdin, fetch := gitpkg.InspectFetch(reader)
+
+	// With protocol v2 each request carries a single ls-refs or fetch
+	// command, which upload-pack answers statelessly.
 	cmd := gitpkg.ServiceCommand{
-		Dir:    repoPath,
-		Args:   []string{"--stateless-rpc"},
-		Stdin:  reader,
-		Stdout: w,
+		Dir:      repoPath,
+		Args:     []string{"--stateless-rpc"},
+		Protocol: gitpkg.SanitizeProtocol(r.Header.Get("Git-Protocol")),
+		Stdin:    stdin,
+		Stdout:   gitpkg.InspectFetchResponse(w, fetch),
 	}
 
 	if err := gitpkg.UploadPackService.Run(r.Context(), cmd); err != nil {
 		slog.Error("git upload-pack failed", "repo", repoName, "error", err)
 		return
 	}
+
+	if fetch.Served() {
+		if err := db.RecordFetch(s.db, repoName, fetch.Filter, fetch.Shallow); err != nil {
+			slog.Error("record fetch", "repo", repoName, "error", err)
+		}
+	}
 }
 
 // gitReceivePackDenied handles POST /{repo}/git-receive-pack with a 403.
@@ -105,20 +123,23 @@ func (s *Server) gitReceivePackDenied(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "push over HTTP is not supported — use SSH", http.StatusForbidden)
 }
 
-// canReadRepo checks if a repository exists and is readable.
-// For now, it checks that the repo is in the DB. Access control for
-// private repos will be added in Phase 7.
-func (s *Server) canReadRepo(name string) bool {
-	var isPrivate bool
-	err := s.db.Get(&isPrivate, "SELECT is_private FROM repositories WHERE name = ?", name)
-	if err != nil {
-		return false // repo doesn't exist
-	}
-	// TODO: Phase 7 — check authentication for private repos
-	if isPrivate {
-		return false // for now, private repos are not accessible via HTTP
+// canReadRepo checks if a repository exists and is readable over HTTP.
+// Private repos need an access token as the Basic auth password, so that
+// "go get" with GOPRIVATE and a netrc entry can clone them.
+func (s *Server) canReadRepo(name string, r *http.Request) bool {
+	return db.CanReadRepo(s.db, name, s.hasValidToken(r))
+}
+
+// denyGitRead answers a git request for a repo that isn't readable. Git
+// only sends credentials after a 401, so requests without any get one
+// whether or not the repo exists; with credentials it is a 404.
+func denyGitRead(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="origin"`)
+		renderStatus(w, http.StatusUnauthorized)
+		return
 	}
-	return true
+	renderStatus(w, http.StatusNotFound)
 }
 
 // sanitizeRepoPath cleans a repo name from the URL path.
@@ -0,0 +1,195 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/mod/module"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+	"github.com/wbrijesh/origin/internal/goproxy"
+)
+
+// Go modules are served two ways. "go get host/repo/..." fetches the page
+// with ?go-get=1 and reads the go-import meta tag, then clones over smart
+// HTTP. With GOPROXY={public_url}/-/goproxy the go command instead
+// downloads versions from the proxy endpoints below, built from tags.
+//
+// Private modules need GOPRIVATE (or GONOSUMDB) set, and an access token
+// as the password in ~/.netrc for the public host.
+
+var goImportTemplate = template.Must(template.New("go-import").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="go-import" content="{{.Prefix}} git {{.CloneURL}}">
+<meta name="go-source" content="{{.Prefix}} {{.Home}} {{.Home}}/tree/{{.Branch}}{/dir} {{.Home}}/blob/{{.Branch}}{/dir}/{file}#L{line}">
+</head>
+<body>go get {{.Prefix}}</body>
+</html>
+`))
+
+// goGet answers "go get" discovery requests (?go-get=1) for any path
+// within a repository with its go-import and go-source meta tags.
+func (s *Server) goGet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Query().Get("go-get") != "1" || strings.HasPrefix(r.URL.Path, "/-/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		first, _, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+		if first == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		repoName := sanitizeRepoPath(first)
+
+		if !s.canAccessRepo(repoName, r) {
+			renderStatus(w, http.StatusNotFound)
+			return
+		}
+
+		branch := "main"
+		if gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName); err == nil {
+			branch = gitpkg.DefaultBranch(gitRepo)
+		}
+
+		home := s.cfg.HTTP.PublicURL + "/" + repoName
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		goImportTemplate.Execute(w, map[string]string{ //nolint:errcheck
+			"Prefix":   s.cfg.PublicHost() + "/" + repoName,
+			"CloneURL": home + ".git",
+			"Home":     home,
+			"Branch":   branch,
+		})
+	})
+}
+
+// handleGoProxy implements the GOPROXY protocol:
+//
+//	GET /-/goproxy/{module}/@v/list
+//	GET /-/goproxy/{module}/@v/{version}.info
+//	GET /-/goproxy/{module}/@v/{version}.mod
+//	GET /-/goproxy/{module}/@v/{version}.zip
+//	GET /-/goproxy/{module}/@latest
+func (s *Server) handleGoProxy(w http.ResponseWriter, r *http.Request) {
+	p := r.PathValue("path")
+
+	var escPath, file string
+	if before, ok := strings.CutSuffix(p, "/@latest"); ok {
+		escPath, file = before, "@latest"
+	} else if i := strings.LastIndex(p, "/@v/"); i >= 0 {
+		escPath, file = p[:i], p[i+len("/@v/"):]
+	} else {
+		renderStatus(w, http.StatusNotFound)
+		return
+	}
+
+	modPath, err := module.UnescapePath(escPath)
+	if err != nil {
+		goProxyError(w, fmt.Errorf("%w: %v", goproxy.ErrNotFound, err))
+		return
+	}
+	mod, err := goproxy.ParseModulePath(s.cfg.PublicHost(), modPath)
+	if err != nil {
+		goProxyError(w, err)
+		return
+	}
+
+	if !s.canAccessRepo(mod.Repo, r) {
+		// As with git, the go command only sends netrc credentials
+		// after being challenged.
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="origin"`)
+			http.Error(w, "authentication required for "+modPath, http.StatusUnauthorized)
+			return
+		}
+		goProxyError(w, fmt.Errorf("%w: module %s", goproxy.ErrNotFound, modPath))
+		return
+	}
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), mod.Repo)
+	if err != nil {
+		goProxyError(w, fmt.Errorf("%w: module %s", goproxy.ErrNotFound, modPath))
+		return
+	}
+
+	if file == "list" {
+		versions, err := mod.Versions(gitRepo)
+		if err != nil {
+			goProxyError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, v := range versions {
+			fmt.Fprintln(w, v)
+		}
+		return
+	}
+
+	if file == "@latest" {
+		info, err := mod.Latest(gitRepo)
+		if err != nil {
+			goProxyError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+		return
+	}
+
+	ext := path.Ext(file)
+	version, err := module.UnescapeVersion(strings.TrimSuffix(file, ext))
+	if err != nil {
+		goProxyError(w, fmt.Errorf("%w: %v", goproxy.ErrNotFound, err))
+		return
+	}
+
+	switch ext {
+	case ".info":
+		info, err := mod.Stat(gitRepo, version)
+		if err != nil {
+			goProxyError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+
+	case ".mod":
+		data, err := mod.GoMod(gitRepo, version)
+		if err != nil {
+			goProxyError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(data) //nolint:errcheck
+
+	case ".zip":
+		// Files are checked before anything is written, so an invalid
+		// module still gets a proper error response.
+		if _, err := mod.GoMod(gitRepo, version); err != nil {
+			goProxyError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		if err := mod.Zip(w, gitRepo, version); err != nil {
+			goProxyError(w, err)
+		}
+
+	default:
+		renderStatus(w, http.StatusNotFound)
+	}
+}
+
+// goProxyError reports an error to the go command, which prints the body
+// of 404 and 410 responses and treats them as "no such module or version".
+func goProxyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, goproxy.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	slog.Error("goproxy", "error", err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
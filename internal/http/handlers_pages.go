@@ -1,19 +1,27 @@
 package http
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/go-git/go-git/v5"
+
+	"github.com/wbrijesh/origin/internal/commitsearch"
+	"github.com/wbrijesh/origin/internal/db"
 	gitpkg "github.com/wbrijesh/origin/internal/git"
+	"github.com/wbrijesh/origin/internal/lang"
 )
 
 // baseData returns common template data for every page.
@@ -43,6 +51,12 @@ type repoRow struct {
 	Description string    `db:"description"`
 	IsPrivate   bool      `db:"is_private"`
 	UpdatedAt   time.Time `db:"updated_at"`
+	Language    string    `db:"language"`
+}
+
+// LanguageColor returns the color of the repo's language badge.
+func (r repoRow) LanguageColor() string {
+	return lang.Color(r.Language)
 }
 
 func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
@@ -59,10 +73,14 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 
 	var repos []repoRow
 	var err error
+	// Each repo's badge is the language with the most bytes in its stats.
+	const query = `SELECT name, description, is_private, updated_at,
+		COALESCE((SELECT language FROM repo_languages l WHERE l.repo_id = repositories.id ORDER BY bytes DESC LIMIT 1), '') AS language
+		FROM repositories`
 	if loggedIn {
-		err = s.db.Select(&repos, "SELECT name, description, is_private, updated_at FROM repositories ORDER BY updated_at DESC")
+		err = s.db.Select(&repos, query+" ORDER BY updated_at DESC")
 	} else {
-		err = s.db.Select(&repos, "SELECT name, description, is_private, updated_at FROM repositories WHERE is_private = 0 ORDER BY updated_at DESC")
+		err = s.db.Select(&repos, query+" WHERE is_private = 0 ORDER BY updated_at DESC")
 	}
 	if err != nil {
 		slog.Error("query repos", "error", err)
@@ -77,13 +95,13 @@ func (s *Server) handleRepo(w http.ResponseWriter, r *http.Request) {
 	data := s.baseData(r)
 
 	// Check repo exists and is accessible
-	var repo repoRow
-	err := s.db.Get(&repo, "SELECT name, description, is_private, updated_at FROM repositories WHERE name = ?", repoName)
-	if err != nil {
+	if !s.canAccessRepo(repoName, r) {
 		s.renderError(w, r, http.StatusNotFound, "Repository not found")
 		return
 	}
-	if repo.IsPrivate && !data["LoggedIn"].(bool) {
+	var repo repoRow
+	err := s.db.Get(&repo, "SELECT name, description, is_private, updated_at FROM repositories WHERE name = ?", repoName)
+	if err != nil {
 		s.renderError(w, r, http.StatusNotFound, "Repository not found")
 		return
 	}
@@ -95,6 +113,9 @@ func (s *Server) handleRepo(w http.ResponseWriter, r *http.Request) {
 	data["ActiveTab"] = "files"
 	data["CloneSSH"] = fmt.Sprintf("%s/%s", s.cfg.SSHCloneBase(), repoName)
 	data["CloneHTTP"] = fmt.Sprintf("%s/%s", s.cfg.HTTP.PublicURL, repoName)
+	if base := s.cfg.GitCloneBase(); base != "" && !repo.IsPrivate {
+		data["CloneGit"] = fmt.Sprintf("%s/%s", base, repoName)
+	}
 
 	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
 	if err != nil {
@@ -107,6 +128,7 @@ func (s *Server) handleRepo(w http.ResponseWriter, r *http.Request) {
 	defaultBranch := gitpkg.DefaultBranch(gitRepo)
 	data["DefaultBranch"] = defaultBranch
 	data["IsEmpty"] = false
+	data["Feeds"] = repoFeeds(repoName, defaultBranch)
 
 	// File tree at root
 	entries, err := gitpkg.Tree(gitRepo, defaultBranch, "")
@@ -116,12 +138,13 @@ func (s *Server) handleRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	data["Entries"] = entries
+	s.loadLastCommits(r, data, gitRepo, repoName, defaultBranch, "")
 
 	// README
 	readmeContent, readmeFile, _ := gitpkg.Readme(gitRepo, defaultBranch)
 	if readmeContent != "" {
 		if strings.HasSuffix(strings.ToLower(readmeFile), ".md") {
-			data["Readme"] = s.render.renderMarkdown(readmeContent)
+			data["Readme"] = s.render.renderMarkdownIn(readmeContent, markdownBase{Repo: repoName, Ref: defaultBranch})
 		} else {
 			data["Readme"] = template.HTML("<pre>" + template.HTMLEscapeString(readmeContent) + "</pre>") //nolint:gosec
 		}
@@ -156,14 +179,20 @@ func buildBreadcrumbs(path string) []Breadcrumb {
 
 func (s *Server) handleTree(w http.ResponseWriter, r *http.Request) {
 	repoName := sanitizeRepoPath(r.PathValue("repo"))
-	ref := r.PathValue("ref")
-	path := r.PathValue("path")
 
 	if !s.canAccessRepo(repoName, r) {
 		s.renderError(w, r, http.StatusNotFound, "Repository not found")
 		return
 	}
 
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
+		return
+	}
+
+	ref, path := gitpkg.SplitRefPath(gitRepo, r.PathValue("refpath"))
+
 	data := s.baseData(r)
 	data["Title"] = fmt.Sprintf("%s — %s", repoName, path)
 	data["RepoName"] = repoName
@@ -187,126 +216,569 @@ func (s *Server) handleTree(w http.ResponseWriter, r *http.Request) {
 		data["ParentPath"] = parent
 	}
 
-	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
-	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
-		return
-	}
-
 	entries, err := gitpkg.Tree(gitRepo, ref, path)
 	if err != nil {
-		s.renderError(w, r, http.StatusNotFound, "Path not found")
+		s.renderRefError(w, r, err, "Path not found")
 		return
 	}
 	data["Entries"] = entries
+	s.loadLastCommits(r, data, gitRepo, repoName, ref, path)
 
 	s.loadRepoMeta(data, repoName)
 	s.render.render(w, "tree", data)
 }
 
+// loadLastCommits sets LastCommits, the commit that last changed each
+// entry of a tree listing. A listing is still shown without them if they
+// can't be worked out.
+func (s *Server) loadLastCommits(r *http.Request, data map[string]any, gitRepo *git.Repository, repoName, ref, path string) {
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	commits, err := s.lastCommits.Get(r.Context(), gitRepo, repoName, repoPath, ref, path)
+	if err != nil {
+		slog.Error("last commits", "repo", repoName, "ref", ref, "path", path, "error", err)
+		commits = map[string]*gitpkg.CommitInfo{} // the templates index it
+	}
+	data["LastCommits"] = commits
+}
+
 func (s *Server) handleBlob(w http.ResponseWriter, r *http.Request) {
 	repoName := sanitizeRepoPath(r.PathValue("repo"))
-	ref := r.PathValue("ref")
-	path := r.PathValue("path")
 
 	if !s.canAccessRepo(repoName, r) {
 		s.renderError(w, r, http.StatusNotFound, "Repository not found")
 		return
 	}
 
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
+		return
+	}
+
+	ref, path := gitpkg.SplitRefPath(gitRepo, r.PathValue("refpath"))
+
 	data := s.baseData(r)
 	data["Title"] = fmt.Sprintf("%s — %s", repoName, filepath.Base(path))
 	data["RepoName"] = repoName
 	data["Ref"] = ref
 	data["FileName"] = filepath.Base(path)
+	data["Path"] = path
 	data["Breadcrumbs"] = buildBreadcrumbs(path)
 
+	blob, err := gitpkg.OpenBlob(gitRepo, ref, path)
+	if err != nil {
+		// Links to directories, as from a README, go to the tree view.
+		if _, terr := gitpkg.Tree(gitRepo, ref, path); terr == nil {
+			http.Redirect(w, r, fmt.Sprintf("/%s/tree/%s/%s", repoName, ref, path), http.StatusFound)
+			return
+		}
+		s.renderRefError(w, r, err, "File not found")
+		return
+	}
+	defer blob.Close()
+
+	// Only as much as will be shown is read; larger files get a
+	// download link instead.
+	content, err := io.ReadAll(io.LimitReader(blob, maxBlobViewSize))
+	if err != nil {
+		slog.Error("read blob", "repo", repoName, "path", path, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+
+	data["FileSize"] = formatSize(blob.Size)
+	data["RawURL"] = fmt.Sprintf("/%s/raw/%s/%s", repoName, ref, path)
+
+	ctype, _ := rawContentType(path, content)
+	switch {
+	case strings.HasPrefix(ctype, "image/"):
+		data["Preview"] = "image"
+	case ctype == "application/pdf":
+		data["Preview"] = "pdf"
+	case gitpkg.IsBinary(content):
+		data["Preview"] = "binary"
+	case blob.Size > maxBlobViewSize:
+		data["Preview"] = "large"
+	default:
+		data["HighlightedContent"] = highlightCode(string(content), filepath.Base(path))
+	}
+
+	s.loadRepoMeta(data, repoName)
+	s.render.render(w, "file", data)
+}
+
+// maxBlobViewSize is the largest file the blob view shows as text.
+const maxBlobViewSize = 1 << 20
+
+// handleRaw serves a file's content as stored, for downloads and for
+// previews in the blob view.
+func (s *Server) handleRaw(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
 	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
 	if err != nil {
 		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
 		return
 	}
 
-	content, size, err := gitpkg.Blob(gitRepo, ref, path)
+	ref, path := gitpkg.SplitRefPath(gitRepo, r.PathValue("refpath"))
+
+	blob, err := gitpkg.OpenBlob(gitRepo, ref, path)
+	if err != nil {
+		s.renderRefError(w, r, err, "File not found")
+		return
+	}
+	defer blob.Close()
+
+	head := make([]byte, 8000)
+	n, err := io.ReadFull(blob, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		slog.Error("read blob", "repo", repoName, "path", path, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+	blob.Seek(0, io.SeekStart) //nolint:errcheck
+
+	ctype, inline := rawContentType(path, head[:n])
+	disposition := "attachment"
+	if inline && r.URL.Query().Get("download") == "" {
+		disposition = "inline"
+	}
+	if d := mime.FormatMediaType(disposition, map[string]string{"filename": filepath.Base(path)}); d != "" {
+		disposition = d
+	}
+
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("ETag", `"`+blob.Hash+`"`)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if ctype == "application/pdf" {
+		// Browsers won't render PDFs in a sandbox; allow the blob view
+		// to embed them.
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'self'")
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	} else {
+		// Repository content is untrusted: never let it run as a page
+		// of this origin, even an SVG opened directly.
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	}
+	http.ServeContent(w, r, "", time.Time{}, blob)
+}
+
+// rawContentType picks the Content-Type for serving a file raw from its
+// name and first bytes, and whether it's safe to show inline. Text of any
+// kind, HTML included, is served as plain text; images, audio, video and
+// PDFs keep their type; anything else is a download.
+func rawContentType(name string, head []byte) (string, bool) {
+	// Signatures are checked first: they can't be faked by a name.
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if isMediaType(sniffed) {
+		return sniffed, true
+	}
+
+	byName, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(name)))
+	if byName == "image/svg+xml" {
+		return byName, true
+	}
+	if !gitpkg.IsBinary(head) {
+		return "text/plain; charset=utf-8", true
+	}
+	if isMediaType(byName) {
+		return byName, true
+	}
+	return "application/octet-stream", false
+}
+
+// isMediaType reports whether a media type is one browsers display inline
+// without running it as a page.
+func isMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "audio/") ||
+		strings.HasPrefix(mediaType, "video/") || mediaType == "application/pdf"
+}
+
+// blameAgeLevels is the number of shades blame hunks are sorted into, from
+// the oldest change in the file to the newest.
+const blameAgeLevels = 10
+
+// blameHunk is a BlameHunk with the shade of its age bar.
+type blameHunk struct {
+	gitpkg.BlameHunk
+	Shade template.CSS
+}
+
+func (s *Server) handleBlame(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
+		return
+	}
+
+	ref, path := gitpkg.SplitRefPath(gitRepo, r.PathValue("refpath"))
+
+	data := s.baseData(r)
+	data["Title"] = fmt.Sprintf("%s — blame %s", repoName, filepath.Base(path))
+	data["RepoName"] = repoName
+	data["Ref"] = ref
+	data["Path"] = path
+	data["FileName"] = filepath.Base(path)
+	data["Breadcrumbs"] = buildBreadcrumbs(path)
+
+	commit, err := gitpkg.ResolveCommit(gitRepo, ref)
+	if err != nil {
+		s.renderRefError(w, r, err, "Ref not found")
+		return
+	}
+
+	if path == "" {
+		s.renderError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	hunks, err := gitpkg.Blame(r.Context(), repoPath, commit.Hash, path)
 	if err != nil {
 		s.renderError(w, r, http.StatusNotFound, "File not found")
 		return
 	}
 
-	data["FileSize"] = formatSize(size)
-	data["HighlightedContent"] = highlightCode(content, filepath.Base(path))
+	// Shade each hunk by where its commit falls between the file's oldest
+	// and newest change; the newest are brightest.
+	var oldest, newest time.Time
+	for i, h := range hunks {
+		if i == 0 || h.Commit.Date.Before(oldest) {
+			oldest = h.Commit.Date
+		}
+		if h.Commit.Date.After(newest) {
+			newest = h.Commit.Date
+		}
+	}
+	shaded := make([]blameHunk, len(hunks))
+	for i, h := range hunks {
+		level := blameAgeLevels - 1
+		if span := newest.Sub(oldest); span > 0 {
+			level = int(float64(blameAgeLevels-1) * float64(h.Commit.Date.Sub(oldest)) / float64(span))
+		}
+		alpha := 0.1 + 0.9*float64(level)/float64(blameAgeLevels-1)
+		shaded[i] = blameHunk{BlameHunk: h, Shade: template.CSS(fmt.Sprintf("rgba(255, 166, 87, %.2f)", alpha))}
+	}
+	data["Hunks"] = shaded
 
 	s.loadRepoMeta(data, repoName)
-	s.render.render(w, "file", data)
+	s.render.render(w, "blame", data)
 }
 
 func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 	repoName := sanitizeRepoPath(r.PathValue("repo"))
-	ref := r.PathValue("ref")
+
+	// Feeds also take a token in the URL, so readers of feeds are a
+	// superset of readers of the page. Anyone else gets the same 404
+	// whether or not the repository or ref exists.
+	if !s.canAccessFeed(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+	if ref, ok := s.logFeedRef(repoName, r.PathValue("refpath")); ok {
+		s.handleLogFeed(w, r, ref)
+		return
+	}
 
 	if !s.canAccessRepo(repoName, r) {
 		s.renderError(w, r, http.StatusNotFound, "Repository not found")
 		return
 	}
 
-	page := 0
-	if p := r.URL.Query().Get("page"); p != "" {
-		page, _ = strconv.Atoi(p)
-		if page < 0 {
-			page = 0
-		}
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
+		return
 	}
 
+	ref, path := gitpkg.SplitRefPath(gitRepo, r.PathValue("refpath"))
+	page := requestPage(r)
+
 	data := s.baseData(r)
 	data["Title"] = fmt.Sprintf("%s — commits", repoName)
 	data["RepoName"] = repoName
 	data["Ref"] = ref
 	data["ActiveTab"] = "commits"
-	data["Page"] = page
-	data["HasPrev"] = page > 0
+	data["LogPath"] = path
+	data["Feeds"] = repoFeeds(repoName, ref)
 
-	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	// The graph toggle stays on the same page.
+	pageParams := url.Values{}
+	if page.After != "" {
+		pageParams.Set("after", page.After)
+	}
+	if page.Before != "" {
+		pageParams.Set("before", page.Before)
+	}
+	data["PageParams"] = template.URL(pageParams.Encode())
+
+	commit, err := gitpkg.ResolveCommit(gitRepo, ref)
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
+		s.renderRefError(w, r, err, "Ref not found")
 		return
 	}
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
 
-	commits, hasMore, err := gitpkg.Log(gitRepo, ref, page, 30)
+	if path != "" {
+		// History of a single file or directory, following renames
+		data["Title"] = fmt.Sprintf("%s — history of %s", repoName, path)
+		data["Breadcrumbs"] = buildBreadcrumbs(path)
+
+		commits, info, err := gitpkg.FileLog(r.Context(), repoPath, commit.Hash, path, page)
+		if errors.Is(err, gitpkg.ErrUnknownRevision) || errors.Is(err, gitpkg.ErrInvalidRevision) {
+			s.renderRefError(w, r, err, "Commit not found")
+			return
+		}
+		if err != nil || (len(commits) == 0 && page.After == "" && page.Before == "") {
+			s.renderError(w, r, http.StatusNotFound, "Path not found")
+			return
+		}
+		data["Commits"] = commits
+		data["Next"] = info.Next
+		if info.Newer && len(commits) > 0 {
+			data["Prev"] = commits[0].Hash
+		}
+	} else {
+		commits, info, err := gitpkg.Log(r.Context(), repoPath, commit.Hash, page)
+		if err != nil {
+			s.renderRefError(w, r, err, "Commit not found")
+			return
+		}
+		data["Commits"] = commits
+		data["Next"] = info.Next
+		if info.Newer && len(commits) > 0 {
+			data["Prev"] = commits[0].Hash
+		}
+
+		// The graph is drawn for the whole history only, where each
+		// commit's parents are in the log.
+		if r.URL.Query().Get("graph") == "1" {
+			data["ShowGraph"] = true
+			data["Graph"] = gitpkg.LayoutGraph(commits)
+		}
+	}
+
+	// Branches and tags are shown beside the commits they point at.
+	decorations := make(map[string][]gitpkg.RefInfo)
+	if refs, err := gitpkg.ListRefs(gitRepo); err == nil {
+		for _, ref := range refs {
+			decorations[ref.Commit] = append(decorations[ref.Commit], ref)
+		}
+	}
+	data["Decorations"] = decorations
+
+	s.loadRepoMeta(data, repoName)
+	s.render.render(w, "log", data)
+}
+
+// handleCommitSearch searches a repository's commits by message, author,
+// committer, date range and path.
+func (s *Server) handleCommitSearch(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	data := s.baseData(r)
+	data["Title"] = fmt.Sprintf("%s — search commits", repoName)
+	data["RepoName"] = repoName
+	data["ActiveTab"] = "commits"
+	data["Form"] = r.URL.Query()
+	s.loadRepoMeta(data, repoName)
+
+	q, err := parseCommitQuery(r)
 	if err != nil {
-		s.renderError(w, r, http.StatusNotFound, "Ref not found")
+		w.WriteHeader(http.StatusBadRequest)
+		data["Error"] = err.Error()
+		s.render.render(w, "commit_search", data)
+		return
+	}
+	if q.IsZero() {
+		s.render.render(w, "commit_search", data)
 		return
 	}
 
+	params := r.URL.Query()
+	params.Del("after")
+	params.Del("before")
+	data["Params"] = template.URL(params.Encode())
+
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	commits, info, err := s.commits.Search(r.Context(), repoName, repoPath, q, requestPage(r))
+	if errors.Is(err, gitpkg.ErrUnknownRevision) {
+		s.renderRefError(w, r, err, "Commit not found")
+		return
+	}
+	if err != nil {
+		slog.Error("search commits", "repo", repoName, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to search commits")
+		return
+	}
+	data["Searched"] = true
 	data["Commits"] = commits
-	data["HasNext"] = hasMore
+	data["Next"] = info.Next
+	if info.Newer && len(commits) > 0 {
+		data["Prev"] = commits[0].Hash
+	}
+	s.render.render(w, "commit_search", data)
+}
 
-	s.loadRepoMeta(data, repoName)
-	s.render.render(w, "log", data)
+// requestPage reads which page of a history to list from the query
+// string: after, the next cursor of the page before, or before, the first
+// commit of the page after.
+func requestPage(r *http.Request) gitpkg.Page {
+	return gitpkg.Page{
+		After:  r.URL.Query().Get("after"),
+		Before: r.URL.Query().Get("before"),
+		Size:   30,
+	}
 }
 
-// DiffLine represents a single line in a diff, with type info for coloring.
-type DiffLine struct {
-	Text   string
-	IsAdd  bool
-	IsDel  bool
-	IsHunk bool
+// parseCommitQuery reads a commit search from the query string: q for the
+// message, author, committer, path, and since and until as YYYY-MM-DD
+// dates (until includes the whole day, in UTC).
+func parseCommitQuery(r *http.Request) (commitsearch.Query, error) {
+	v := r.URL.Query()
+	q := commitsearch.Query{
+		Text:      strings.TrimSpace(v.Get("q")),
+		Author:    strings.TrimSpace(v.Get("author")),
+		Committer: strings.TrimSpace(v.Get("committer")),
+		Path:      strings.Trim(strings.TrimSpace(v.Get("path")), "/"),
+	}
+	if since := strings.TrimSpace(v.Get("since")); since != "" {
+		t, err := time.Parse(time.DateOnly, since)
+		if err != nil {
+			return q, fmt.Errorf("since must be a date like 2006-01-02")
+		}
+		q.Since = t
+	}
+	if until := strings.TrimSpace(v.Get("until")); until != "" {
+		t, err := time.Parse(time.DateOnly, until)
+		if err != nil {
+			return q, fmt.Errorf("until must be a date like 2006-01-02")
+		}
+		q.Until = t.Add(24*time.Hour - time.Second)
+	}
+	return q, nil
 }
 
-func parseDiffLines(patch string) []DiffLine {
-	var lines []DiffLine
-	for _, line := range strings.Split(patch, "\n") {
-		dl := DiffLine{Text: line}
-		switch {
-		case strings.HasPrefix(line, "+"):
-			dl.IsAdd = true
-		case strings.HasPrefix(line, "-"):
-			dl.IsDel = true
-		case strings.HasPrefix(line, "@@"):
-			dl.IsHunk = true
+// handleCompare shows the commits and combined diff between two revisions,
+// given as "base...head" (diff from the merge base) or "base..head"
+// (direct diff). A ".patch" suffix downloads the commits as an mbox, and
+// ".diff" the combined diff. An omitted base is the default branch and an
+// omitted head is HEAD.
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	// The compare form submits base and head as query parameters.
+	if q := r.URL.Query(); q.Has("head") {
+		http.Redirect(w, r, fmt.Sprintf("/%s/compare/%s...%s", repoName, url.PathEscape(q.Get("base")), url.PathEscape(q.Get("head"))), http.StatusSeeOther)
+		return
+	}
+
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
+		return
+	}
+
+	data := s.baseData(r)
+	data["Title"] = fmt.Sprintf("%s — compare", repoName)
+	data["RepoName"] = repoName
+	data["ActiveTab"] = "refs"
+	data["Base"] = gitpkg.DefaultBranch(gitRepo)
+	data["Head"] = ""
+
+	spec := r.PathValue("spec")
+	if spec == "" {
+		s.loadRepoMeta(data, repoName)
+		s.render.render(w, "compare", data)
+		return
+	}
+
+	spec, format := spec, "html"
+	for _, f := range []string{"patch", "diff"} {
+		if rest, ok := strings.CutSuffix(spec, "."+f); ok {
+			spec, format = rest, f
+			break
+		}
+	}
+
+	// Ref names cannot contain "..", so the first one splits the spec.
+	sep := "..."
+	base, head, ok := strings.Cut(spec, sep)
+	if !ok {
+		sep = ".."
+		base, head, ok = strings.Cut(spec, sep)
+	}
+	if !ok {
+		s.renderError(w, r, http.StatusNotFound, "Compare two revisions as base...head or base..head")
+		return
+	}
+	if base == "" {
+		base = gitpkg.DefaultBranch(gitRepo)
+	}
+	if head == "" {
+		head = "HEAD"
+	}
+
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	cmp, err := gitpkg.Compare(r.Context(), gitRepo, repoPath, base, head, sep == "...")
+	if err != nil {
+		s.renderRefError(w, r, err, "Ref not found")
+		return
+	}
+
+	switch format {
+	case "patch":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := gitpkg.FormatPatch(r.Context(), repoPath, cmp, w); err != nil {
+			slog.Error("format patch", "repo", repoName, "spec", spec, "error", err)
+		}
+		return
+	case "diff":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := gitpkg.WriteDiff(r.Context(), repoPath, cmp, w); err != nil {
+			slog.Error("write diff", "repo", repoName, "spec", spec, "error", err)
 		}
-		lines = append(lines, dl)
+		return
 	}
-	return lines
+
+	data["Title"] = fmt.Sprintf("%s — %s%s%s", repoName, base, sep, head)
+	data["Base"] = base
+	data["Head"] = head
+	data["Sep"] = sep
+	data["Spec"] = spec
+	data["Comparison"] = cmp
+	data["MoreCommits"] = cmp.Ahead - len(cmp.Commits)
+	data["Diff"] = cmp.Diff
+	data["DiffFiles"] = prepareDiff(cmp.Diff)
+	data["DiffView"] = diffView(r)
+	data["DiffRef"] = cmp.Head.Hash
+
+	s.loadRepoMeta(data, repoName)
+	s.render.render(w, "compare", data)
 }
 
 func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
@@ -319,7 +791,6 @@ func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := s.baseData(r)
-	data["Title"] = fmt.Sprintf("%s — %s", repoName, hash[:7])
 	data["RepoName"] = repoName
 
 	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
@@ -328,15 +799,35 @@ func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	diff, commit, err := gitpkg.Diff(gitRepo, hash)
+	// ?parent=N diffs a commit against its Nth parent; by default merges
+	// get a combined diff.
+	parent := 0
+	if p := r.URL.Query().Get("parent"); p != "" {
+		if parent, err = strconv.Atoi(p); err != nil {
+			s.renderError(w, r, http.StatusBadRequest, "Invalid parent")
+			return
+		}
+	}
+
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	diff, commit, err := gitpkg.Diff(r.Context(), gitRepo, repoPath, hash, parent)
 	if err != nil {
-		s.renderError(w, r, http.StatusNotFound, "Commit not found")
+		s.renderRefError(w, r, err, "Commit not found")
 		return
 	}
 
+	data["Title"] = fmt.Sprintf("%s — %s", repoName, commit.ShortHash)
+
 	data["Commit"] = commit
 	data["Diff"] = diff
-	data["DiffLines"] = parseDiffLines(diff.Patch)
+	data["DiffFiles"] = prepareDiff(diff)
+	data["DiffView"] = diffView(r)
+	data["DiffRef"] = commit.Hash
+	data["Parent"] = parent
+	if diff.Combined {
+		// Combined diffs have no single old side to split against.
+		data["DiffView"] = "unified"
+	}
 
 	// Extract full message (lines after first)
 	msg := commit.Message
@@ -390,64 +881,161 @@ func (s *Server) handleRefs(w http.ResponseWriter, r *http.Request) {
 	data["Branches"] = branches
 	data["Tags"] = tags
 
+	releaseTags := make(map[string]bool)
+	if releases, err := s.releases.List(repoName, s.isLoggedIn(r)); err == nil {
+		for _, rel := range releases {
+			releaseTags[rel.Tag] = true
+		}
+	}
+	data["ReleaseTags"] = releaseTags
+
 	s.loadRepoMeta(data, repoName)
 	s.render.render(w, "refs", data)
 }
 
+// handleStats shows a repository's languages, top contributors, commit
+// activity over the last year and size.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	data := s.baseData(r)
+	data["Title"] = fmt.Sprintf("%s — stats", repoName)
+	data["RepoName"] = repoName
+	data["ActiveTab"] = "stats"
+
+	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
+	st, err := s.stats.Get(r.Context(), repoName, repoPath)
+	if err != nil {
+		slog.Error("load stats", "repo", repoName, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to compute stats")
+		return
+	}
+	if st != nil {
+		data["Stats"] = st
+		data["Calendar"] = st.Calendar(time.Now())
+	}
+
+	s.loadRepoMeta(data, repoName)
+	s.render.render(w, "stats", data)
+}
+
 func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
 	repoName := sanitizeRepoPath(r.PathValue("repo"))
-	ref := r.PathValue("ref")
-	ref = strings.TrimSuffix(ref, ".tar.gz")
+	// The whole rest of the path is the ref, so it may contain slashes.
+	name, checksum := strings.CutSuffix(r.PathValue("name"), ".sha256")
+	ref, format := splitArchiveName(name)
 
 	if !s.canAccessRepo(repoName, r) {
 		s.renderError(w, r, http.StatusNotFound, "Repository not found")
 		return
 	}
 
+	if !s.cfg.ArchiveFormatAllowed(format) {
+		s.renderError(w, r, http.StatusNotFound, "Archive format not available")
+		return
+	}
+
 	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
 	if err != nil {
 		s.renderError(w, r, http.StatusInternalServerError, "Failed to open repository")
 		return
 	}
 
-	// Get all files recursively
-	files, err := gitpkg.Archive(gitRepo, ref)
+	archive, err := gitpkg.OpenArchive(gitRepo, ref, r.URL.Query().Get("path"))
 	if err != nil {
-		s.renderError(w, r, http.StatusNotFound, "Ref not found")
+		s.renderRefError(w, r, err, "Ref or path not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/gzip")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.tar.gz", repoName, ref))
+	// Refs may contain slashes; keep the file and top-level directory flat.
+	base := repoName + "-" + strings.ReplaceAll(ref, "/", "-")
+	if archive.Path != "" {
+		base += "-" + strings.ReplaceAll(archive.Path, "/", "-")
+	}
 
-	gz := gzip.NewWriter(w)
-	defer gz.Close()
-	tw := tar.NewWriter(gz)
-	defer tw.Close()
+	if !s.archives.Enabled() {
+		s.streamArchive(w, r, archive, format, base, checksum)
+		return
+	}
 
-	prefix := repoName + "-" + ref + "/"
-	for _, f := range files {
-		tw.WriteHeader(&tar.Header{ //nolint:errcheck
-			Name:    prefix + f.Path,
-			Size:    int64(len(f.Content)),
-			Mode:    0o644,
-			ModTime: time.Now(),
-		})
-		io.WriteString(tw, f.Content) //nolint:errcheck
+	entry, err := s.archives.Get(repoName, archive, format, base)
+	if err != nil {
+		slog.Error("build archive", "repo", repoName, "ref", ref, "format", format, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to build archive")
+		return
 	}
-}
 
-// canAccessRepo checks if a repo is accessible for the current request.
-func (s *Server) canAccessRepo(name string, r *http.Request) bool {
-	var isPrivate bool
-	err := s.db.Get(&isPrivate, "SELECT is_private FROM repositories WHERE name = ?", name)
+	if checksum {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, entry.Checksum()) //nolint:errcheck
+		return
+	}
+
+	f, err := os.Open(entry.Path)
 	if err != nil {
-		return false
+		// Evicted between Get and Open; the next request rebuilds it.
+		s.renderError(w, r, http.StatusServiceUnavailable, "Archive is being rebuilt, try again")
+		return
 	}
-	if isPrivate && !s.isLoggedIn(r) {
-		return false
+	defer f.Close()
+
+	w.Header().Set("Content-Type", gitpkg.ArchiveContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", entry.Name))
+	w.Header().Set("ETag", `"`+entry.SHA256+`"`)
+	w.Header().Set("Digest", "sha-256="+entry.SHA256)
+	http.ServeContent(w, r, entry.Name, archive.Time, f)
+}
+
+// streamArchive writes an archive straight to the response when the archive
+// cache is disabled. Checksums are computed by generating the archive into
+// the hash instead.
+func (s *Server) streamArchive(w http.ResponseWriter, r *http.Request, archive *gitpkg.Archive, format, base string, checksum bool) {
+	if checksum {
+		h := sha256.New()
+		if err := archive.Write(h, format, base+"/"); err != nil {
+			slog.Error("checksum archive", "path", r.URL.Path, "error", err)
+			s.renderError(w, r, http.StatusInternalServerError, "Failed to build archive")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "%x  %s.%s\n", h.Sum(nil), base, format)
+		return
+	}
+
+	w.Header().Set("Content-Type", gitpkg.ArchiveContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", base+"."+format))
+	w.Header().Set("Last-Modified", archive.Time.UTC().Format(http.TimeFormat))
+
+	if err := archive.Write(w, format, base+"/"); err != nil {
+		// Headers are already sent; all we can do is cut the stream short.
+		slog.Error("write archive", "path", r.URL.Path, "format", format, "error", err)
+	}
+}
+
+// splitArchiveName splits an archive URL segment such as "v1.0.tar.gz" into
+// its ref and format. A bare ref gets a tar.gz, which is what the archive
+// links have always served.
+func splitArchiveName(name string) (ref, format string) {
+	for _, f := range append(gitpkg.ArchiveFormats, "tgz") {
+		if r, ok := strings.CutSuffix(name, "."+f); ok && r != "" {
+			if f == "tgz" {
+				f = "tar.gz"
+			}
+			return r, f
+		}
 	}
-	return true
+	return name, "tar.gz"
+}
+
+// canAccessRepo checks if a repo is accessible for the current request.
+// Private repos need a session or an access token.
+func (s *Server) canAccessRepo(name string, r *http.Request) bool {
+	return db.CanReadRepo(s.db, name, s.isLoggedIn(r) || s.hasValidToken(r))
 }
 
 // loadRepoMeta loads common repo metadata into template data.
@@ -466,6 +1054,20 @@ func (s *Server) loadRepoMeta(data map[string]any, repoName string) {
 			data["DefaultBranch"] = "main"
 		}
 	}
+	if _, ok := data["Feeds"]; !ok {
+		data["Feeds"] = repoFeeds(repoName, data["DefaultBranch"].(string))
+	}
+}
+
+// renderRefError renders the 404 for a ref that didn't resolve. Ambiguous
+// short hashes and malformed revisions get the reason spelled out; anything
+// else gets the generic message.
+func (s *Server) renderRefError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var ambiguous *gitpkg.AmbiguousError
+	if errors.As(err, &ambiguous) || errors.Is(err, gitpkg.ErrInvalidRevision) {
+		message = err.Error()
+	}
+	s.renderError(w, r, http.StatusNotFound, message)
 }
 
 // renderError renders an error page.
@@ -0,0 +1,377 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+	"github.com/wbrijesh/origin/internal/release"
+)
+
+// --- Release Pages ---
+
+func (s *Server) handleReleases(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	releases, err := s.releases.List(repoName, s.isLoggedIn(r))
+	if err != nil {
+		slog.Error("list releases", "repo", repoName, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list releases")
+		return
+	}
+
+	data := s.baseData(r)
+	data["Title"] = fmt.Sprintf("%s — releases", repoName)
+	data["RepoName"] = repoName
+	data["ActiveTab"] = "releases"
+	data["Releases"] = releases
+	data["LatestID"] = int64(0)
+	if latest, err := s.releases.Latest(repoName); err == nil {
+		data["LatestID"] = latest.ID
+	}
+
+	s.loadDefaultBranch(data, repoName)
+	s.loadRepoMeta(data, repoName)
+	s.render.render(w, "releases", data)
+}
+
+func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+	tag := r.PathValue("tag")
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	rel, err := s.releases.Get(repoName, tag)
+	if err != nil || (rel.IsDraft && !s.isLoggedIn(r)) {
+		s.renderError(w, r, http.StatusNotFound, "Release not found")
+		return
+	}
+
+	data := s.baseData(r)
+	data["Title"] = fmt.Sprintf("%s — %s", repoName, rel.DisplayTitle())
+	data["RepoName"] = repoName
+	data["ActiveTab"] = "releases"
+	data["Releases"] = []release.Release{*rel}
+	data["Single"] = true
+	data["LatestID"] = int64(0)
+	if latest, err := s.releases.Latest(repoName); err == nil {
+		data["LatestID"] = latest.ID
+	}
+
+	s.loadDefaultBranch(data, repoName)
+	s.loadRepoMeta(data, repoName)
+	s.render.render(w, "releases", data)
+}
+
+// handleLatestRelease redirects to the latest published release, so
+// /{repo}/releases/latest is a stable link.
+func (s *Server) handleLatestRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	rel, err := s.releases.Latest(repoName)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "No published releases")
+		return
+	}
+
+	http.Redirect(w, r, releaseURL(repoName, rel.Tag), http.StatusFound)
+}
+
+// handleLatestReleaseAsset redirects to an asset of the latest release,
+// e.g. /{repo}/releases/latest/download/tool_linux_amd64.tar.gz.
+func (s *Server) handleLatestReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+	name := r.PathValue("name")
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	rel, err := s.releases.Latest(repoName)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "No published releases")
+		return
+	}
+	if _, err := rel.FindAsset(name); err != nil {
+		s.renderError(w, r, http.StatusNotFound, "Asset not found")
+		return
+	}
+
+	http.Redirect(w, r, assetURL(repoName, rel.Tag, name), http.StatusFound)
+}
+
+func (s *Server) handleReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+	tag := r.PathValue("tag")
+	name := r.PathValue("name")
+
+	if !s.canAccessRepo(repoName, r) {
+		s.renderError(w, r, http.StatusNotFound, "Repository not found")
+		return
+	}
+
+	rel, err := s.releases.Get(repoName, tag)
+	if err != nil || (rel.IsDraft && !s.isLoggedIn(r) && !s.hasValidToken(r)) {
+		s.renderError(w, r, http.StatusNotFound, "Release not found")
+		return
+	}
+	asset, err := rel.FindAsset(name)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "Asset not found")
+		return
+	}
+
+	f, err := os.Open(s.releases.AssetPath(asset))
+	if err != nil {
+		slog.Error("open release asset", "repo", repoName, "tag", tag, "asset", name, "error", err)
+		s.renderError(w, r, http.StatusNotFound, "Asset not found")
+		return
+	}
+	defer f.Close()
+
+	// Count whole downloads, not each range request of a resumed one.
+	if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+		s.releases.RecordDownload(asset)
+	}
+
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", asset.Name))
+	w.Header().Set("ETag", `"`+asset.SHA256+`"`)
+	w.Header().Set("Digest", "sha-256="+asset.SHA256)
+	http.ServeContent(w, r, asset.Name, asset.CreatedAt, f)
+}
+
+// --- Release Management ---
+
+func (s *Server) handleNewRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+	s.renderReleaseForm(w, r, repoName, &release.Release{Tag: r.URL.Query().Get("tag")}, "")
+}
+
+func (s *Server) handleEditRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel, err := s.releaseFromPath(repoName, r)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "Release not found")
+		return
+	}
+
+	s.renderReleaseForm(w, r, repoName, rel, "")
+}
+
+// renderReleaseForm shows the create/edit form. A release with an ID is
+// being edited; its tag can no longer change.
+func (s *Server) renderReleaseForm(w http.ResponseWriter, r *http.Request, repoName string, rel *release.Release, formErr string) {
+	data := s.baseData(r)
+	data["RepoName"] = repoName
+	data["ActiveTab"] = "releases"
+	data["Release"] = rel
+	if rel.ID == 0 {
+		data["Title"] = fmt.Sprintf("%s — new release", repoName)
+	} else {
+		data["Title"] = fmt.Sprintf("%s — edit %s", repoName, rel.Tag)
+	}
+	if formErr != "" {
+		data["Error"] = formErr
+	}
+
+	// Offer the tags that don't have a release yet
+	if rel.ID == 0 {
+		existing := make(map[string]bool)
+		if releases, err := s.releases.List(repoName, true); err == nil {
+			for _, rel := range releases {
+				existing[rel.Tag] = true
+			}
+		}
+		if gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName); err == nil {
+			if refs, err := gitpkg.ListRefs(gitRepo); err == nil {
+				var tags []string
+				for _, ref := range refs {
+					if ref.IsTag && !existing[ref.Name] {
+						tags = append(tags, ref.Name)
+					}
+				}
+				data["Tags"] = tags
+			}
+		}
+	}
+
+	s.loadDefaultBranch(data, repoName)
+	s.loadRepoMeta(data, repoName)
+	s.render.render(w, "release_form", data)
+}
+
+func (s *Server) handleCreateRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel := &release.Release{
+		Tag:          strings.TrimSpace(r.FormValue("tag")),
+		Title:        strings.TrimSpace(r.FormValue("title")),
+		Notes:        r.FormValue("notes"),
+		IsDraft:      r.FormValue("draft") == "on",
+		IsPrerelease: r.FormValue("prerelease") == "on",
+	}
+
+	if err := s.releases.Create(repoName, rel); err != nil {
+		msg := "Failed to create release."
+		switch {
+		case errors.Is(err, release.ErrNoTag):
+			msg = "Tag " + rel.Tag + " does not exist. Push the tag first."
+		case errors.Is(err, release.ErrExists):
+			msg = "A release for " + rel.Tag + " already exists."
+		default:
+			slog.Error("create release", "repo", repoName, "tag", rel.Tag, "error", err)
+		}
+		s.renderReleaseForm(w, r, repoName, rel, msg)
+		return
+	}
+
+	http.Redirect(w, r, releaseURL(repoName, rel.Tag), http.StatusSeeOther)
+}
+
+func (s *Server) handleUpdateRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel, err := s.releaseFromPath(repoName, r)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "Release not found")
+		return
+	}
+
+	rel.Title = strings.TrimSpace(r.FormValue("title"))
+	rel.Notes = r.FormValue("notes")
+	rel.IsDraft = r.FormValue("draft") == "on"
+	rel.IsPrerelease = r.FormValue("prerelease") == "on"
+
+	if err := s.releases.Update(rel); err != nil {
+		slog.Error("update release", "repo", repoName, "tag", rel.Tag, "error", err)
+		s.renderReleaseForm(w, r, repoName, rel, "Failed to save release.")
+		return
+	}
+
+	http.Redirect(w, r, releaseURL(repoName, rel.Tag), http.StatusSeeOther)
+}
+
+func (s *Server) handleDeleteRelease(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	if rel, err := s.releaseFromPath(repoName, r); err == nil {
+		if err := s.releases.Delete(rel); err != nil {
+			slog.Error("delete release", "repo", repoName, "tag", rel.Tag, "error", err)
+		}
+	}
+
+	http.Redirect(w, r, "/"+repoName+"/releases", http.StatusSeeOther)
+}
+
+func (s *Server) handleUploadReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel, err := s.releaseFromPath(repoName, r)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "Release not found")
+		return
+	}
+
+	// Stream the multipart body instead of buffering it with ParseMultipartForm
+	mr, err := r.MultipartReader()
+	if err != nil {
+		s.renderReleaseForm(w, r, repoName, rel, "Expected a file upload.")
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		if part.FormName() != "asset" || part.FileName() == "" {
+			continue
+		}
+
+		_, err = s.releases.AddAsset(rel, part.FileName(), part.Header.Get("Content-Type"), part, s.cfg.Releases.MaxAssetMB<<20)
+		part.Close()
+		if err != nil {
+			s.renderReleaseForm(w, r, repoName, rel, assetErrorMessage(err, part.FileName(), s.cfg.Releases.MaxAssetMB))
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/"+repoName+"/-/releases/"+strconv.FormatInt(rel.ID, 10)+"/edit", http.StatusSeeOther)
+}
+
+func (s *Server) handleDeleteReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	repoName := sanitizeRepoPath(r.PathValue("repo"))
+
+	rel, err := s.releaseFromPath(repoName, r)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "Release not found")
+		return
+	}
+
+	if asset, err := rel.FindAsset(r.PathValue("name")); err == nil {
+		if err := s.releases.DeleteAsset(asset); err != nil {
+			slog.Error("delete release asset", "repo", repoName, "asset", asset.Name, "error", err)
+		}
+	}
+
+	http.Redirect(w, r, "/"+repoName+"/-/releases/"+strconv.FormatInt(rel.ID, 10)+"/edit", http.StatusSeeOther)
+}
+
+// releaseFromPath loads the release named by the {id} path value.
+func (s *Server) releaseFromPath(repoName string, r *http.Request) (*release.Release, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, release.ErrNotFound
+	}
+	return s.releases.GetByID(repoName, id)
+}
+
+// loadDefaultBranch sets DefaultBranch for the repo tabs.
+func (s *Server) loadDefaultBranch(data map[string]any, repoName string) {
+	data["DefaultBranch"] = "main"
+	if gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName); err == nil {
+		data["DefaultBranch"] = gitpkg.DefaultBranch(gitRepo)
+	}
+}
+
+func assetErrorMessage(err error, name string, maxMB int64) string {
+	switch {
+	case errors.Is(err, release.ErrInvalidName):
+		return fmt.Sprintf("Invalid asset name %q: use letters, digits, '.', '_', '+' and '-'.", name)
+	case errors.Is(err, release.ErrExists):
+		return fmt.Sprintf("An asset named %q already exists. Delete it first to replace it.", name)
+	case errors.Is(err, release.ErrTooLarge):
+		return fmt.Sprintf("Asset %q is larger than %d MB.", name, maxMB)
+	}
+	slog.Error("upload release asset", "asset", name, "error", err)
+	return "Failed to upload " + name + "."
+}
+
+func releaseURL(repoName, tag string) string {
+	return "/" + repoName + "/releases/tag/" + url.PathEscape(tag)
+}
+
+func assetURL(repoName, tag, name string) string {
+	return "/" + repoName + "/releases/download/" + url.PathEscape(tag) + "/" + url.PathEscape(name)
+}
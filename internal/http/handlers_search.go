@@ -0,0 +1,67 @@
+package http
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+	"github.com/wbrijesh/origin/internal/search"
+)
+
+// --- Code Search ---
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := search.Query{
+		Pattern: strings.TrimSpace(r.URL.Query().Get("q")),
+		Regex:   r.URL.Query().Get("regex") == "1",
+		Repo:    r.URL.Query().Get("repo"),
+		Lang:    r.URL.Query().Get("lang"),
+	}
+
+	data := s.baseData(r)
+	data["Title"] = "Search"
+	data["Query"] = q
+	if q.Pattern == "" {
+		s.render.render(w, "search", data)
+		return
+	}
+	data["Title"] = "Search — " + q.Pattern
+
+	// Private repos are searched with a session or an access token, as
+	// for canAccessRepo.
+	query := "SELECT name FROM repositories WHERE is_private = 0 ORDER BY name"
+	if s.isLoggedIn(r) || s.hasValidToken(r) {
+		query = "SELECT name FROM repositories ORDER BY name"
+	}
+	var names []string
+	if err := s.db.Select(&names, query); err != nil {
+		slog.Error("query repos", "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Search failed")
+		return
+	}
+	var repos []search.Repo
+	for _, name := range names {
+		gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), name)
+		if err != nil {
+			continue
+		}
+		repos = append(repos, search.Repo{Name: name, Git: gitRepo})
+	}
+
+	results, err := s.searcher.Search(r.Context(), repos, q)
+	if err != nil {
+		if errors.Is(err, search.ErrInvalidQuery) {
+			w.WriteHeader(http.StatusBadRequest)
+			data["Error"] = err.Error()
+			s.render.render(w, "search", data)
+			return
+		}
+		slog.Error("search", "query", q.Pattern, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Search failed")
+		return
+	}
+	data["Results"] = results
+	s.render.render(w, "search", data)
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	mdrenderer "github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Markdown is rendered as GitHub Flavored Markdown, with IDs on headings
+// and a "#" link to each, and fenced code blocks highlighted by chroma
+// with the classes the page's chroma CSS styles. Raw HTML is left out.
+// The output is still passed through the sanitizer.
+
+// newMarkdown creates the Markdown converter.
+func newMarkdown() goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithASTTransformers(util.Prioritized(&markdownLinks{}, 100)),
+		),
+		goldmark.WithRendererOptions(
+			mdrenderer.WithNodeRenderers(util.Prioritized(&codeBlockRenderer{}, 100)),
+		),
+	)
+}
+
+// markdownBase is where a Markdown document lives in a repository, for
+// resolving its relative links.
+type markdownBase struct {
+	Repo string
+	Ref  string
+	Dir  string // directory of the document, "" for the root
+}
+
+var markdownBaseKey = parser.NewContextKey()
+
+// renderMarkdownIn is renderMarkdown for a document in a repository:
+// relative links lead to the files they name in base's ref, and relative
+// images load from their raw URLs.
+func (r *renderer) renderMarkdownIn(input string, base markdownBase) template.HTML {
+	ctx := parser.NewContext()
+	ctx.Set(markdownBaseKey, base)
+
+	var buf bytes.Buffer
+	if err := r.markdown.Convert([]byte(input), &buf, parser.WithContext(ctx)); err != nil {
+		slog.Error("markdown render failed", "error", err)
+		return template.HTML("<pre>" + template.HTMLEscapeString(input) + "</pre>")
+	}
+	safe := r.sanitizer.SanitizeBytes(buf.Bytes())
+	return template.HTML(safe) //nolint:gosec
+}
+
+// markdownLinks adds the "#" links to headings and, when the document has
+// a markdownBase, rewrites its relative links and images.
+type markdownLinks struct{}
+
+func (t *markdownLinks) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	base, hasBase := pc.Get(markdownBaseKey).(markdownBase)
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) { //nolint:errcheck
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			if id, ok := n.AttributeString("id"); ok {
+				anchor := ast.NewLink()
+				anchor.Destination = append([]byte("#"), id.([]byte)...)
+				anchor.SetAttributeString("class", []byte("anchor"))
+				anchor.AppendChild(anchor, ast.NewString([]byte("#")))
+				n.AppendChild(n, anchor)
+			}
+		case *ast.Link:
+			if hasBase {
+				n.Destination = base.resolve(n.Destination, "blob")
+			}
+		case *ast.Image:
+			if hasBase {
+				n.Destination = base.resolve(n.Destination, "raw")
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// resolve returns the URL of the page of view ("blob" or "raw") showing
+// the file a relative link names. Links to directories, ending in "/",
+// go to the tree view. A path starting with "/" is relative to the
+// repository's root, as on GitHub. Other links are returned as they are.
+func (b markdownBase) resolve(dest []byte, view string) []byte {
+	u, err := url.Parse(string(dest))
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return dest
+	}
+
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join("/", b.Dir, p)
+	}
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	if strings.HasSuffix(u.Path, "/") || p == "" {
+		view = "tree"
+	}
+
+	resolved := url.URL{Path: "/" + b.Repo + "/" + view + "/" + b.Ref + "/" + p, RawQuery: u.RawQuery, Fragment: u.Fragment}
+	return []byte(strings.TrimSuffix(resolved.String(), "/"))
+}
+
+// codeBlockRenderer renders fenced code blocks highlighted by chroma.
+type codeBlockRenderer struct{}
+
+func (cr *codeBlockRenderer) RegisterFuncs(reg mdrenderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, cr.renderFencedCodeBlock)
+}
+
+func (cr *codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+
+	var code bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+
+	var lexer chroma.Lexer
+	if lang := n.Language(source); lang != nil {
+		lexer = lexers.Get(string(lang))
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	style := styles.Get("github")
+	if style == nil {
+		style = styles.Fallback
+	}
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.TabWidth(4))
+
+	var out bytes.Buffer
+	iterator, err := lexer.Tokenise(nil, code.String())
+	if err == nil {
+		err = formatter.Format(&out, style, iterator)
+	}
+	if err != nil {
+		_, _ = w.WriteString("<pre><code>" + template.HTMLEscapeString(code.String()) + "</code></pre>\n")
+		return ast.WalkSkipChildren, nil
+	}
+	_, _ = w.Write(out.Bytes())
+	return ast.WalkSkipChildren, nil
+}
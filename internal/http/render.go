@@ -9,7 +9,10 @@ import (
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -19,6 +22,8 @@ import (
 	"github.com/alecthomas/chroma/v2/styles"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/yuin/goldmark"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
 )
 
 //go:embed templates/*
@@ -36,21 +41,28 @@ func newRenderer() *renderer {
 	funcMap := template.FuncMap{
 		"timeAgo":   timeAgo,
 		"shortHash": shortHash,
-		"highlight":  highlightCode,
+		"highlight": highlightCode,
 		"renderMarkdown": func(s string) template.HTML {
 			return "" // placeholder, replaced below
 		},
-		"join":      strings.Join,
-		"trimSpace": strings.TrimSpace,
-		"firstLine": firstLine,
-		"pathJoin":  filepath.Join,
-		"add": func(a, b int) int { return a + b },
-		"sub": func(a, b int) int { return a - b },
+		"join":          strings.Join,
+		"trimSpace":     strings.TrimSpace,
+		"firstLine":     firstLine,
+		"pathJoin":      filepath.Join,
+		"formatSize":    formatSize,
+		"add":           func(a, b int) int { return a + b },
+		"sub":           func(a, b int) int { return a - b },
+		"submoduleLink": submoduleLink,
+		"graph":         graphSVG,
 	}
 
-	md := goldmark.New()
+	md := newMarkdown()
 	sanitizer := bluemonday.UGCPolicy()
 	sanitizer.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).OnElements("code", "pre", "span", "div")
+	sanitizer.AllowAttrs("class").Matching(regexp.MustCompile(`^anchor$`)).OnElements("a")
+	// GFM task list items
+	sanitizer.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	sanitizer.AllowAttrs("checked", "disabled").OnElements("input")
 
 	r := &renderer{
 		funcMap:   funcMap,
@@ -150,6 +162,7 @@ func highlightCode(code, filename string) template.HTML {
 	formatter := chromahtml.New(
 		chromahtml.WithClasses(true),
 		chromahtml.WithLineNumbers(true),
+		chromahtml.WithLinkableLineNumbers(true, "L"),
 		chromahtml.TabWidth(4),
 	)
 
@@ -223,9 +236,89 @@ func shortHash(hash string) string {
 	return hash
 }
 
+// submoduleLink returns a web link for a submodule URL from .gitmodules.
+// Relative URLs name repos on this server, relative to repoName as git
+// resolves them; ssh, git and scp-style URLs are assumed to have an https
+// page at the same host and path. It returns "" for anything else.
+func submoduleLink(repoName, rawURL string) string {
+	u := strings.TrimSuffix(rawURL, "/")
+	if strings.HasPrefix(u, "./") || strings.HasPrefix(u, "../") {
+		return strings.TrimSuffix(path.Join("/", repoName, u), ".git")
+	}
+
+	if !strings.Contains(u, "://") {
+		// scp-style "user@host:path"
+		host, p, ok := strings.Cut(u, ":")
+		if !ok || strings.Contains(host, "/") {
+			return ""
+		}
+		if i := strings.LastIndexByte(host, '@'); i >= 0 {
+			host = host[i+1:]
+		}
+		u = "https://" + host + "/" + strings.TrimPrefix(p, "/")
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	switch parsed.Scheme {
+	case "http", "https":
+	case "ssh", "git", "git+ssh":
+		parsed.Scheme = "https"
+		parsed.Host = parsed.Hostname()
+	default:
+		return ""
+	}
+	parsed.User = nil
+	parsed.Path = strings.TrimSuffix(parsed.Path, ".git")
+	return parsed.String()
+}
+
 func firstLine(s string) string {
 	if i := strings.IndexByte(s, '\n'); i >= 0 {
 		return s[:i]
 	}
 	return s
 }
+
+// Commit graph drawing: each log row is graphRowHeight pixels tall, and
+// lanes are graphLaneWidth apart.
+const (
+	graphLaneWidth = 14
+	graphRowHeight = 40
+)
+
+// graphColors are the lane colors, repeating across wide graphs.
+var graphColors = []string{"#60a5fa", "#f472b6", "#34d399", "#fbbf24", "#a78bfa", "#f87171", "#22d3ee", "#a3e635"}
+
+// graphSVG draws one row of the commit graph as an inline SVG. Lines run
+// one pixel past the row so they cover the border between table rows.
+func graphSVG(row gitpkg.GraphRow) template.HTML {
+	x := func(lane int) int { return lane*graphLaneWidth + graphLaneWidth/2 }
+	color := func(lane int) string { return graphColors[lane%len(graphColors)] }
+	mid, bottom := graphRowHeight/2, graphRowHeight+1
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg width="%d" height="%d" overflow="visible" class="block" aria-hidden="true">`,
+		row.Width*graphLaneWidth, graphRowHeight)
+	for _, l := range row.Lines {
+		// Top lines keep the color of the lane they come from, bottom
+		// lines take the color of the lane they lead to.
+		y1, y2, c := 0, mid, color(l.From)
+		if !l.Top {
+			y1, y2, c = mid, bottom, color(l.To)
+		}
+		x1, x2 := x(l.From), x(l.To)
+		if x1 == x2 {
+			fmt.Fprintf(&b, `<path d="M%d %dV%d" stroke="%s" stroke-width="2" fill="none"/>`, x1, y1, y2, c)
+			continue
+		}
+		ym := (y1 + y2) / 2
+		fmt.Fprintf(&b, `<path d="M%d %dC%d %d %d %d %d %d" stroke="%s" stroke-width="2" fill="none"/>`,
+			x1, y1, x1, ym, x2, ym, x2, y2, c)
+	}
+	fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="4" fill="%s"/>`, x(row.Column), mid, color(row.Column))
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String()) //nolint:gosec
+}
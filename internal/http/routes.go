@@ -31,6 +31,27 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /-/repos/new", s.requireAuth(s.handleNewRepo))
 	mux.HandleFunc("POST /-/repos", s.requireAuth(s.handleCreateRepo))
 
+	// JSON API (access token required for writes)
+	mux.HandleFunc("GET /-/api/repos/{repo}/commits", s.apiListCommits)
+	mux.HandleFunc("GET /-/api/repos/{repo}/commits/search", s.apiSearchCommits)
+	mux.HandleFunc("GET /-/api/repos/{repo}/releases", s.apiListReleases)
+	mux.HandleFunc("GET /-/api/repos/{repo}/releases/latest", s.apiGetRelease)
+	mux.HandleFunc("GET /-/api/repos/{repo}/releases/tags/{tag}", s.apiGetRelease)
+	mux.HandleFunc("POST /-/api/repos/{repo}/releases", s.requireToken(s.apiCreateRelease))
+	mux.HandleFunc("PATCH /-/api/repos/{repo}/releases/{id}", s.requireToken(s.apiUpdateRelease))
+	mux.HandleFunc("DELETE /-/api/repos/{repo}/releases/{id}", s.requireToken(s.apiDeleteRelease))
+	mux.HandleFunc("POST /-/api/repos/{repo}/releases/{id}/assets", s.requireToken(s.apiUploadReleaseAsset))
+	mux.HandleFunc("DELETE /-/api/repos/{repo}/releases/{id}/assets/{name}", s.requireToken(s.apiDeleteReleaseAsset))
+
+	// Code search
+	mux.HandleFunc("GET /-/search", s.handleSearch)
+
+	// Server-wide activity feed
+	mux.HandleFunc("GET /-/activity.atom", s.handleActivityFeed)
+
+	// Go module proxy (GOPROXY protocol)
+	mux.HandleFunc("GET /-/goproxy/{path...}", s.handleGoProxy)
+
 	// Home page
 	mux.HandleFunc("GET /{$}", s.handleHome)
 
@@ -46,13 +67,31 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /{repo}/-/delete", s.requireAuth(s.handleDeleteRepo))
 	mux.HandleFunc("POST /{repo}/-/webhooks", s.requireAuth(s.handleAddWebhook))
 	mux.HandleFunc("POST /{repo}/-/webhooks/{wid}/delete", s.requireAuth(s.handleDeleteWebhook))
+	mux.HandleFunc("GET /{repo}/-/releases/new", s.requireAuth(s.handleNewRelease))
+	mux.HandleFunc("POST /{repo}/-/releases", s.requireAuth(s.handleCreateRelease))
+	mux.HandleFunc("GET /{repo}/-/releases/{id}/edit", s.requireAuth(s.handleEditRelease))
+	mux.HandleFunc("POST /{repo}/-/releases/{id}", s.requireAuth(s.handleUpdateRelease))
+	mux.HandleFunc("POST /{repo}/-/releases/{id}/delete", s.requireAuth(s.handleDeleteRelease))
+	mux.HandleFunc("POST /{repo}/-/releases/{id}/assets", s.requireAuth(s.handleUploadReleaseAsset))
+	mux.HandleFunc("POST /{repo}/-/releases/{id}/assets/{name}/delete", s.requireAuth(s.handleDeleteReleaseAsset))
 
 	// Web UI — repo pages
 	mux.HandleFunc("GET /{repo}/{$}", s.handleRepo)
-	mux.HandleFunc("GET /{repo}/tree/{ref}/{path...}", s.handleTree)
-	mux.HandleFunc("GET /{repo}/blob/{ref}/{path...}", s.handleBlob)
-	mux.HandleFunc("GET /{repo}/log/{ref}", s.handleLog)
+	mux.HandleFunc("GET /{repo}/tree/{refpath...}", s.handleTree)
+	mux.HandleFunc("GET /{repo}/blob/{refpath...}", s.handleBlob)
+	mux.HandleFunc("GET /{repo}/raw/{refpath...}", s.handleRaw)
+	mux.HandleFunc("GET /{repo}/blame/{refpath...}", s.handleBlame)
+	mux.HandleFunc("GET /{repo}/log/{refpath...}", s.handleLog)
+	mux.HandleFunc("GET /{repo}/search", s.handleCommitSearch)
 	mux.HandleFunc("GET /{repo}/commit/{hash}", s.handleCommit)
 	mux.HandleFunc("GET /{repo}/refs", s.handleRefs)
-	mux.HandleFunc("GET /{repo}/archive/{ref}", s.handleArchive)
+	mux.HandleFunc("GET /{repo}/tags.atom", s.handleTagsFeed)
+	mux.HandleFunc("GET /{repo}/stats", s.handleStats)
+	mux.HandleFunc("GET /{repo}/compare/{spec...}", s.handleCompare)
+	mux.HandleFunc("GET /{repo}/archive/{name...}", s.handleArchive)
+	mux.HandleFunc("GET /{repo}/releases", s.handleReleases)
+	mux.HandleFunc("GET /{repo}/releases/latest", s.handleLatestRelease)
+	mux.HandleFunc("GET /{repo}/releases/latest/download/{name}", s.handleLatestReleaseAsset)
+	mux.HandleFunc("GET /{repo}/releases/tag/{tag}", s.handleRelease)
+	mux.HandleFunc("GET /{repo}/releases/download/{tag}/{name}", s.handleReleaseAsset)
 }
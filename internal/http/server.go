@@ -8,23 +8,42 @@ import (
 
 	"github.com/jmoiron/sqlx"
 
+	"github.com/wbrijesh/origin/internal/archive"
+	"github.com/wbrijesh/origin/internal/commitsearch"
 	"github.com/wbrijesh/origin/internal/config"
+	"github.com/wbrijesh/origin/internal/lastcommit"
+	"github.com/wbrijesh/origin/internal/release"
+	"github.com/wbrijesh/origin/internal/search"
+	"github.com/wbrijesh/origin/internal/stats"
 )
 
 // Server is the HTTP server for the web UI and git protocol.
 type Server struct {
-	cfg    *config.Config
-	db     *sqlx.DB
-	server *http.Server
-	render *renderer
+	cfg         *config.Config
+	db          *sqlx.DB
+	server      *http.Server
+	render      *renderer
+	archives    *archive.Cache
+	releases    *release.Store
+	lastCommits *lastcommit.Cache
+	searcher    *search.Searcher
+	commits     *commitsearch.Index
+	stats       *stats.Store
+	activity    activityCache
 }
 
 // New creates a new HTTP server with all routes registered.
 func New(cfg *config.Config, db *sqlx.DB) *Server {
 	s := &Server{
-		cfg:    cfg,
-		db:     db,
-		render: newRenderer(),
+		cfg:         cfg,
+		db:          db,
+		render:      newRenderer(),
+		archives:    archive.New(archive.CacheDir(cfg.DataPath), cfg.Archive.CacheMaxMB<<20),
+		releases:    release.New(cfg, db),
+		lastCommits: lastcommit.New(db),
+		searcher:    search.New(search.IndexDir(cfg.DataPath)),
+		commits:     commitsearch.New(db),
+		stats:       stats.New(db),
 	}
 
 	mux := http.NewServeMux()
@@ -32,7 +51,7 @@ func New(cfg *config.Config, db *sqlx.DB) *Server {
 
 	s.server = &http.Server{
 		Addr:    cfg.HTTP.ListenAddr,
-		Handler: s.securityHeaders(s.requestLogger(mux)),
+		Handler: s.securityHeaders(s.requestLogger(s.goGet(mux))),
 	}
 
 	// Configure TLS if certs are provided
@@ -0,0 +1,215 @@
+// Package lang names the programming language of a file from its path,
+// for search filters and repository language statistics.
+package lang
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// byExtension maps lower-case file extensions to language names.
+var byExtension = map[string]string{
+	".go":     "Go",
+	".c":      "C",
+	".h":      "C",
+	".cc":     "C++",
+	".cpp":    "C++",
+	".cxx":    "C++",
+	".hh":     "C++",
+	".hpp":    "C++",
+	".cs":     "C#",
+	".java":   "Java",
+	".kt":     "Kotlin",
+	".kts":    "Kotlin",
+	".scala":  "Scala",
+	".swift":  "Swift",
+	".m":      "Objective-C",
+	".rs":     "Rust",
+	".zig":    "Zig",
+	".py":     "Python",
+	".rb":     "Ruby",
+	".php":    "PHP",
+	".pl":     "Perl",
+	".lua":    "Lua",
+	".r":      "R",
+	".jl":     "Julia",
+	".ex":     "Elixir",
+	".exs":    "Elixir",
+	".erl":    "Erlang",
+	".hs":     "Haskell",
+	".ml":     "OCaml",
+	".clj":    "Clojure",
+	".dart":   "Dart",
+	".js":     "JavaScript",
+	".mjs":    "JavaScript",
+	".cjs":    "JavaScript",
+	".jsx":    "JavaScript",
+	".ts":     "TypeScript",
+	".tsx":    "TypeScript",
+	".vue":    "Vue",
+	".svelte": "Svelte",
+	".html":   "HTML",
+	".htm":    "HTML",
+	".css":    "CSS",
+	".scss":   "SCSS",
+	".sass":   "SCSS",
+	".less":   "Less",
+	".sh":     "Shell",
+	".bash":   "Shell",
+	".zsh":    "Shell",
+	".fish":   "Shell",
+	".ps1":    "PowerShell",
+	".sql":    "SQL",
+	".proto":  "Protocol Buffers",
+	".tf":     "HCL",
+	".hcl":    "HCL",
+	".nix":    "Nix",
+	".md":     "Markdown",
+	".rst":    "reStructuredText",
+	".tex":    "TeX",
+	".json":   "JSON",
+	".yaml":   "YAML",
+	".yml":    "YAML",
+	".toml":   "TOML",
+	".xml":    "XML",
+}
+
+// byName maps whole file names to language names.
+var byName = map[string]string{
+	"Makefile":       "Makefile",
+	"GNUmakefile":    "Makefile",
+	"makefile":       "Makefile",
+	"Dockerfile":     "Dockerfile",
+	"Containerfile":  "Dockerfile",
+	"CMakeLists.txt": "CMake",
+	"Rakefile":       "Ruby",
+	"Gemfile":        "Ruby",
+	"go.mod":         "Go Module",
+	"go.sum":         "Go Checksums",
+}
+
+// Detect returns the language of the file at p, or "" if it isn't known.
+func Detect(p string) string {
+	name := path.Base(p)
+	if l, ok := byName[name]; ok {
+		return l
+	}
+	if strings.HasPrefix(name, "Dockerfile.") {
+		return "Dockerfile"
+	}
+	if l, ok := byExtension[strings.ToLower(path.Ext(name))]; ok {
+		return l
+	}
+	return chromaLang(name)
+}
+
+// chromaNames caches chromaLang by file extension, or by name for files
+// without one, as matching against every lexer's patterns is slow. Names
+// whose match doesn't depend on their extension alone aren't cached.
+var chromaNames sync.Map
+
+// chromaLang names the language of files not in the tables above by the
+// chroma lexer that highlights them.
+func chromaLang(name string) string {
+	key := path.Ext(name)
+	if key == "" {
+		key = name
+	} else if !extensionDecides(name, key) {
+		return matchLexer(name)
+	}
+	if l, ok := chromaNames.Load(key); ok {
+		return l.(string)
+	}
+	l := matchLexer(name)
+	chromaNames.Store(key, l)
+	return l
+}
+
+func matchLexer(name string) string {
+	if lexer := lexers.Match(name); lexer != nil && lexer.Config().Name != "plaintext" {
+		return lexer.Config().Name
+	}
+	return ""
+}
+
+// nameGlobs are the lexers' file name patterns that say more than an
+// extension, such as "nginx.conf", ".htaccess" or "*.rs.in".
+var nameGlobs = sync.OnceValue(func() []string {
+	var globs []string
+	for _, lexer := range lexers.GlobalLexerRegistry.Lexers {
+		config := lexer.Config()
+		for _, g := range append(config.Filenames, config.AliasFilenames...) {
+			if ext, ok := strings.CutPrefix(g, "*."); !ok || strings.ContainsAny(ext, ".*") {
+				globs = append(globs, g)
+			}
+		}
+	}
+	return globs
+})
+
+// extensionDecides reports whether the lexer matching name depends only
+// on its extension ext, so that other files with ext share it. Chroma
+// also matches editor backups by a pattern with a suffix such as ".bak"
+// added, so the name without ext must not match anything either.
+func extensionDecides(name, ext string) bool {
+	stem := strings.TrimSuffix(name, ext)
+	if strings.Contains(stem, ".") {
+		return false
+	}
+	for _, g := range nameGlobs() {
+		if ok, _ := path.Match(g, name); ok {
+			return false
+		}
+		if ok, _ := path.Match(g, stem); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// colors are the colors languages are shown in, as on GitHub.
+var colors = map[string]string{
+	"Go":         "#00ADD8",
+	"C":          "#555555",
+	"C++":        "#f34b7d",
+	"C#":         "#178600",
+	"Java":       "#b07219",
+	"Kotlin":     "#A97BFF",
+	"Scala":      "#c22d40",
+	"Swift":      "#F05138",
+	"Rust":       "#dea584",
+	"Zig":        "#ec915c",
+	"Python":     "#3572A5",
+	"Ruby":       "#701516",
+	"PHP":        "#4F5D95",
+	"Lua":        "#000080",
+	"Elixir":     "#6e4a7e",
+	"Haskell":    "#5e5086",
+	"Dart":       "#00B4AB",
+	"JavaScript": "#f1e05a",
+	"TypeScript": "#3178c6",
+	"Vue":        "#41b883",
+	"Svelte":     "#ff3e00",
+	"HTML":       "#e34c26",
+	"CSS":        "#563d7c",
+	"SCSS":       "#c6538c",
+	"Shell":      "#89e051",
+	"SQL":        "#e38c00",
+	"Nix":        "#7e7eff",
+	"Markdown":   "#083fa1",
+	"Dockerfile": "#384d54",
+	"Makefile":   "#427819",
+	"YAML":       "#cb171e",
+	"JSON":       "#292929",
+}
+
+// Color returns the color language is shown in, as a CSS hex color.
+func Color(language string) string {
+	if c, ok := colors[language]; ok {
+		return c
+	}
+	return "#888888"
+}
@@ -0,0 +1,120 @@
+// Package lastcommit finds the commit that last changed each entry of a
+// directory, for tree listings. Answers are kept in the database keyed by
+// the commit that last changed the directory, so a listing is computed once
+// per change to the directory rather than once per view. The tree alone
+// would not do: a revert or another branch can reach the same tree through
+// a different history. The post-receive hook drops a repository's answers
+// after every push so those for commits no longer pushed don't pile up.
+package lastcommit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/jmoiron/sqlx"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+)
+
+// Cache reads and stores last-commit answers.
+type Cache struct {
+	db *sqlx.DB
+}
+
+// New creates a cache backed by db.
+func New(db *sqlx.DB) *Cache {
+	return &Cache{db: db}
+}
+
+type row struct {
+	Entry       string    `db:"entry"`
+	CommitHash  string    `db:"commit_hash"`
+	Author      string    `db:"author"`
+	AuthorEmail string    `db:"author_email"`
+	AuthoredAt  time.Time `db:"authored_at"`
+	Summary     string    `db:"summary"`
+}
+
+// Get returns the last commit of each entry in the directory dir ("" for
+// the root) of rev, keyed by entry name.
+func (c *Cache) Get(ctx context.Context, repo *git.Repository, repoName, repoPath, rev, dir string) (map[string]*gitpkg.CommitInfo, error) {
+	if dir = strings.Trim(dir, "/"); dir == "." {
+		dir = ""
+	}
+
+	commit, err := gitpkg.ResolveCommit(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get tree: %w", err)
+	}
+	if dir != "" {
+		if tree, err = tree.Tree(dir); err != nil {
+			return nil, fmt.Errorf("get subtree %s: %w", dir, err)
+		}
+	}
+	dirCommit, err := gitpkg.LastChange(ctx, repoPath, commit.Hash, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []row
+	err = c.db.Select(&rows, `
+		SELECT l.entry, l.commit_hash, l.author, l.author_email, l.authored_at, l.summary
+		FROM dir_last_commits l JOIN repositories r ON l.repo_id = r.id
+		WHERE r.name = ? AND l.dir_commit = ? AND l.path = ?`,
+		repoName, dirCommit, dir,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load last commits: %w", err)
+	}
+	if len(rows) > 0 {
+		result := make(map[string]*gitpkg.CommitInfo, len(rows))
+		for _, r := range rows {
+			result[r.Entry] = &gitpkg.CommitInfo{
+				Hash:        r.CommitHash,
+				ShortHash:   r.CommitHash[:7],
+				Author:      r.Author,
+				AuthorEmail: r.AuthorEmail,
+				Date:        r.AuthoredAt,
+				Message:     r.Summary,
+			}
+		}
+		return result, nil
+	}
+
+	names := make([]string, len(tree.Entries))
+	for i, e := range tree.Entries {
+		names[i] = e.Name
+	}
+	result, err := gitpkg.LastCommits(ctx, repoPath, commit.Hash, dir, names)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("save last commits: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	for name, info := range result {
+		_, err := tx.Exec(`
+			INSERT OR REPLACE INTO dir_last_commits (repo_id, dir_commit, path, entry, commit_hash, author, author_email, authored_at, summary)
+			SELECT id, ?, ?, ?, ?, ?, ?, ?, ? FROM repositories WHERE name = ?`,
+			dirCommit, dir, name, info.Hash, info.Author, info.AuthorEmail, info.Date.UTC(), info.Message, repoName,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("save last commits: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("save last commits: %w", err)
+	}
+
+	return result, nil
+}
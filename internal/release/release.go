@@ -0,0 +1,325 @@
+// Package release manages tag-backed releases: a title, markdown notes and
+// uploaded binary assets attached to a git tag. Release metadata lives in
+// the database; asset files are stored under {data_path}/releases/{id}/.
+package release
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/wbrijesh/origin/internal/config"
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+)
+
+var (
+	ErrNotFound    = errors.New("release not found")
+	ErrExists      = errors.New("already exists")
+	ErrNoTag       = errors.New("tag does not exist")
+	ErrInvalidName = errors.New("invalid asset name")
+	ErrTooLarge    = errors.New("asset too large")
+)
+
+// validAssetName allows plain file names such as "origin_1.2.0_linux_amd64.tar.gz".
+var validAssetName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]{0,254}$`)
+
+// Release is a tag with a title, notes and assets.
+type Release struct {
+	ID           int64      `db:"id" json:"id"`
+	Tag          string     `db:"tag" json:"tag"`
+	Title        string     `db:"title" json:"title"`
+	Notes        string     `db:"notes" json:"notes"`
+	IsDraft      bool       `db:"is_draft" json:"draft"`
+	IsPrerelease bool       `db:"is_prerelease" json:"prerelease"`
+	PublishedAt  *time.Time `db:"published_at" json:"published_at"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	Assets       []Asset    `db:"-" json:"assets"`
+}
+
+// DisplayTitle returns the title, falling back to the tag name.
+func (r *Release) DisplayTitle() string {
+	if r.Title != "" {
+		return r.Title
+	}
+	return r.Tag
+}
+
+// Asset is a file uploaded to a release.
+type Asset struct {
+	ID          int64     `db:"id" json:"id"`
+	ReleaseID   int64     `db:"release_id" json:"-"`
+	Name        string    `db:"name" json:"name"`
+	Size        int64     `db:"size" json:"size"`
+	ContentType string    `db:"content_type" json:"content_type"`
+	SHA256      string    `db:"sha256" json:"sha256"`
+	Downloads   int       `db:"downloads" json:"downloads"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// Store reads and writes releases and their asset files.
+type Store struct {
+	cfg *config.Config
+	db  *sqlx.DB
+}
+
+// New creates a release store.
+func New(cfg *config.Config, db *sqlx.DB) *Store {
+	return &Store{cfg: cfg, db: db}
+}
+
+const releaseColumns = "r.id, r.tag, r.title, r.notes, r.is_draft, r.is_prerelease, r.published_at, r.created_at"
+
+// List returns the releases of a repository, newest first. Drafts are only
+// included when includeDrafts is set.
+func (s *Store) List(repoName string, includeDrafts bool) ([]Release, error) {
+	query := "SELECT " + releaseColumns + ` FROM releases r JOIN repositories p ON r.repo_id = p.id
+		WHERE p.name = ? AND (? OR r.is_draft = 0)
+		ORDER BY COALESCE(r.published_at, r.created_at) DESC, r.id DESC`
+
+	var releases []Release
+	if err := s.db.Select(&releases, query, repoName, includeDrafts); err != nil {
+		return nil, fmt.Errorf("list releases: %w", err)
+	}
+	for i := range releases {
+		if err := s.loadAssets(&releases[i]); err != nil {
+			return nil, err
+		}
+	}
+	return releases, nil
+}
+
+// Get returns the release for a tag.
+func (s *Store) Get(repoName, tag string) (*Release, error) {
+	return s.getOne("p.name = ? AND r.tag = ?", repoName, tag)
+}
+
+// GetByID returns a release by ID, scoped to a repository.
+func (s *Store) GetByID(repoName string, id int64) (*Release, error) {
+	return s.getOne("p.name = ? AND r.id = ?", repoName, id)
+}
+
+// Latest returns the most recently published release that is neither a
+// draft nor a pre-release.
+func (s *Store) Latest(repoName string) (*Release, error) {
+	return s.getOne(`p.name = ? AND r.is_draft = 0 AND r.is_prerelease = 0
+		ORDER BY r.published_at DESC, r.id DESC LIMIT 1`, repoName)
+}
+
+func (s *Store) getOne(where string, args ...any) (*Release, error) {
+	var rel Release
+	query := "SELECT " + releaseColumns + " FROM releases r JOIN repositories p ON r.repo_id = p.id WHERE " + where
+	if err := s.db.Get(&rel, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get release: %w", err)
+	}
+	if err := s.loadAssets(&rel); err != nil {
+		return nil, err
+	}
+	return &rel, nil
+}
+
+func (s *Store) loadAssets(rel *Release) error {
+	rel.Assets = nil
+	err := s.db.Select(&rel.Assets,
+		"SELECT id, release_id, name, size, content_type, sha256, downloads, created_at FROM release_assets WHERE release_id = ? ORDER BY name",
+		rel.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("list assets: %w", err)
+	}
+	return nil
+}
+
+// Create adds a release for an existing tag. Non-draft releases are
+// published immediately.
+func (s *Store) Create(repoName string, rel *Release) error {
+	gitRepo, err := gitpkg.OpenRepo(s.cfg.ReposPath(), repoName)
+	if err != nil {
+		return err
+	}
+	if _, err := gitRepo.Reference(plumbing.NewTagReferenceName(rel.Tag), false); err != nil {
+		return ErrNoTag
+	}
+
+	if _, err := s.Get(repoName, rel.Tag); err == nil {
+		return fmt.Errorf("release for %s: %w", rel.Tag, ErrExists)
+	}
+
+	var publishedAt *time.Time
+	if !rel.IsDraft {
+		now := time.Now().UTC()
+		publishedAt = &now
+	}
+
+	res, err := s.db.Exec(`INSERT INTO releases (repo_id, tag, title, notes, is_draft, is_prerelease, published_at)
+		SELECT id, ?, ?, ?, ?, ?, ? FROM repositories WHERE name = ?`,
+		rel.Tag, rel.Title, rel.Notes, rel.IsDraft, rel.IsPrerelease, publishedAt, repoName,
+	)
+	if err != nil {
+		return fmt.Errorf("create release: %w", err)
+	}
+	rel.ID, _ = res.LastInsertId()
+	rel.PublishedAt = publishedAt
+	return nil
+}
+
+// Update saves a release's title, notes and flags. A draft that is no
+// longer a draft is published now.
+func (s *Store) Update(rel *Release) error {
+	if !rel.IsDraft && rel.PublishedAt == nil {
+		now := time.Now().UTC()
+		rel.PublishedAt = &now
+	}
+	_, err := s.db.Exec(
+		"UPDATE releases SET title = ?, notes = ?, is_draft = ?, is_prerelease = ?, published_at = ? WHERE id = ?",
+		rel.Title, rel.Notes, rel.IsDraft, rel.IsPrerelease, rel.PublishedAt, rel.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update release: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a release and its asset files.
+func (s *Store) Delete(rel *Release) error {
+	if _, err := s.db.Exec("DELETE FROM releases WHERE id = ?", rel.ID); err != nil {
+		return fmt.Errorf("delete release: %w", err)
+	}
+	return os.RemoveAll(s.releaseDir(rel.ID))
+}
+
+// AddAsset stores r as a new asset of rel, reading at most maxBytes.
+// The content type is guessed from the name when empty.
+func (s *Store) AddAsset(rel *Release, name, contentType string, r io.Reader, maxBytes int64) (*Asset, error) {
+	if !validAssetName.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+	for _, a := range rel.Assets {
+		if a.Name == name {
+			return nil, fmt.Errorf("asset %s: %w", name, ErrExists)
+		}
+	}
+
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	dir := s.releaseDir(rel.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create asset dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	// Read one byte past the limit to tell "exactly maxBytes" from "more".
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("write asset: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if size > maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	asset := &Asset{
+		ReleaseID:   rel.ID,
+		Name:        name,
+		Size:        size,
+		ContentType: contentType,
+		SHA256:      hex.EncodeToString(h.Sum(nil)),
+		CreatedAt:   time.Now().UTC(),
+	}
+	res, err := s.db.Exec(
+		"INSERT INTO release_assets (release_id, name, size, content_type, sha256) VALUES (?, ?, ?, ?, ?)",
+		asset.ReleaseID, asset.Name, asset.Size, asset.ContentType, asset.SHA256,
+	)
+	if err != nil {
+		os.Remove(path) //nolint:errcheck
+		return nil, fmt.Errorf("record asset: %w", err)
+	}
+	asset.ID, _ = res.LastInsertId()
+	rel.Assets = append(rel.Assets, *asset)
+	return asset, nil
+}
+
+// FindAsset returns the asset of rel with the given name.
+func (rel *Release) FindAsset(name string) (*Asset, error) {
+	for i := range rel.Assets {
+		if rel.Assets[i].Name == name {
+			return &rel.Assets[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// DeleteAsset removes an asset and its file.
+func (s *Store) DeleteAsset(asset *Asset) error {
+	if _, err := s.db.Exec("DELETE FROM release_assets WHERE id = ?", asset.ID); err != nil {
+		return fmt.Errorf("delete asset: %w", err)
+	}
+	err := os.Remove(s.AssetPath(asset))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// AssetPath returns where an asset's file is stored.
+func (s *Store) AssetPath(asset *Asset) string {
+	return filepath.Join(s.releaseDir(asset.ReleaseID), asset.Name)
+}
+
+// RecordDownload bumps an asset's download counter.
+func (s *Store) RecordDownload(asset *Asset) {
+	s.db.Exec("UPDATE release_assets SET downloads = downloads + 1 WHERE id = ?", asset.ID) //nolint:errcheck
+}
+
+// RemoveRepo deletes the asset files of every release in a repository.
+// It must run before the repository row is deleted, which cascades to
+// the release rows.
+func (s *Store) RemoveRepo(repoName string) error {
+	var ids []int64
+	err := s.db.Select(&ids, "SELECT r.id FROM releases r JOIN repositories p ON r.repo_id = p.id WHERE p.name = ?", repoName)
+	if err != nil {
+		return fmt.Errorf("list releases: %w", err)
+	}
+	for _, id := range ids {
+		if err := os.RemoveAll(s.releaseDir(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) releaseDir(id int64) string {
+	return filepath.Join(s.cfg.DataPath, "releases", fmt.Sprint(id))
+}
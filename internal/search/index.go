@@ -0,0 +1,225 @@
+// Package search implements code search over the default branch of each
+// repository. Every repository has an on-disk index listing its text files
+// with the trigrams (three-byte sequences, ASCII lower-cased) they contain;
+// a query is narrowed to the files holding all of its trigrams, and only
+// those are read and matched line by line.
+//
+// Indexes are rebuilt incrementally: files whose blob hash hasn't changed
+// keep their trigrams, so a push reads only what it changed. The
+// post-receive hook updates the index after every push, and a search
+// brings a repository's index up to date first if it has fallen behind.
+package search
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+	"github.com/wbrijesh/origin/internal/lang"
+)
+
+// maxFileSize is the size above which files are left out of the index.
+const maxFileSize = 1 << 20
+
+// IndexDir returns the search index directory inside a data directory.
+func IndexDir(dataPath string) string {
+	return filepath.Join(dataPath, "search")
+}
+
+// index is the stored form of a repository's index.
+type index struct {
+	Branch string
+	Commit string
+	Files  []indexFile
+}
+
+type indexFile struct {
+	Path     string
+	Blob     string
+	Lang     string
+	Trigrams []uint32 // sorted
+}
+
+// indexPath returns where the index of a repository is stored.
+func indexPath(dir, repoName string) string {
+	return filepath.Join(dir, repoName+".idx")
+}
+
+// Update brings the index of a repository up to date with its default
+// branch. It does nothing if the branch hasn't moved or doesn't exist yet.
+func Update(dir, repoName string, repo *git.Repository) error {
+	_, err := update(dir, repoName, repo)
+	return err
+}
+
+// update is Update, returning the index as it now stands (nil for an
+// empty repository).
+func update(dir, repoName string, repo *git.Repository) (*index, error) {
+	branch := gitpkg.DefaultBranch(repo)
+	commit, err := gitpkg.ResolveCommit(repo, branch)
+	if err != nil {
+		return nil, nil
+	}
+
+	// A missing or unreadable index is rebuilt from scratch.
+	old, _ := readIndex(indexPath(dir, repoName))
+	if old != nil && old.Branch == branch && old.Commit == commit.Hash.String() {
+		return old, nil
+	}
+
+	known := make(map[string]*indexFile)
+	if old != nil {
+		for i := range old.Files {
+			known[old.Files[i].Blob] = &old.Files[i]
+		}
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get tree: %w", err)
+	}
+	idx := &index{Branch: branch, Commit: commit.Hash.String()}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("walk tree: %w", err)
+		}
+		if entry.Mode != filemode.Regular && entry.Mode != filemode.Executable {
+			continue
+		}
+
+		hash := entry.Hash.String()
+		if f, ok := known[hash]; ok {
+			idx.Files = append(idx.Files, indexFile{Path: name, Blob: hash, Lang: lang.Detect(name), Trigrams: f.Trigrams})
+			continue
+		}
+		content, err := readBlob(repo, hash)
+		if err != nil || content == nil {
+			continue
+		}
+		f := indexFile{Path: name, Blob: hash, Lang: lang.Detect(name), Trigrams: trigrams(content)}
+		known[hash] = &f
+		idx.Files = append(idx.Files, f)
+	}
+
+	if err := writeIndex(indexPath(dir, repoName), idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Remove drops the index of a repository.
+func Remove(dir, repoName string) error {
+	err := os.Remove(indexPath(dir, repoName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readBlob returns the content of a text blob, or nil if it is binary or
+// too large to index.
+func readBlob(repo *git.Repository, hash string) ([]byte, error) {
+	blob, err := repo.BlobObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, fmt.Errorf("get blob %s: %w", hash, err)
+	}
+	if blob.Size > maxFileSize {
+		return nil, nil
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("read blob %s: %w", hash, err)
+	}
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read blob %s: %w", hash, err)
+	}
+	if gitpkg.IsBinary(content) {
+		return nil, nil
+	}
+	return content, nil
+}
+
+func readIndex(path string) (*index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var idx index
+	if err := gob.NewDecoder(f).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("read index %s: %w", path, err)
+	}
+	return &idx, nil
+}
+
+// writeIndex writes the index to a temporary file and renames it into
+// place, so readers never see a partial index.
+func writeIndex(path string, idx *index) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if err := gob.NewEncoder(tmp).Encode(idx); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+	return nil
+}
+
+// trigrams returns the sorted, distinct trigrams of content. Trigrams
+// spanning a line break are left out, since matching is line by line.
+func trigrams(content []byte) []uint32 {
+	seen := make(map[uint32]struct{})
+	for i := 0; i+2 < len(content); i++ {
+		a, b, c := content[i], content[i+1], content[i+2]
+		if a == '\n' || b == '\n' || c == '\n' {
+			continue
+		}
+		seen[trigram(a, b, c)] = struct{}{}
+	}
+	out := make([]uint32, 0, len(seen))
+	for t := range seen {
+		out = append(out, t)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func trigram(a, b, c byte) uint32 {
+	return uint32(lower(a))<<16 | uint32(lower(b))<<8 | uint32(lower(c))
+}
+
+func lower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
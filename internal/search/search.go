@@ -0,0 +1,469 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+)
+
+// Limits on the work done and results returned for one query.
+const (
+	maxPatternLen   = 256
+	maxFiles        = 50   // files listed in the results
+	maxFacetFiles   = 1000 // matching files counted towards the filters
+	maxReadFiles    = 5000 // candidate files read and matched
+	maxLinesPerFile = 5    // matching lines shown per file
+)
+
+// Searcher answers queries from the on-disk indexes, keeping the ones it
+// has loaded in memory until they change.
+type Searcher struct {
+	dir string
+
+	mu       sync.Mutex
+	indexes  map[string]*loadedIndex
+	building map[string]*indexBuild // indexes being built, by repository
+}
+
+// indexBuild is an index being built; done is closed when li and err are set.
+type indexBuild struct {
+	done chan struct{}
+	li   *loadedIndex
+	err  error
+}
+
+type loadedIndex struct {
+	modTime  time.Time
+	idx      *index
+	postings map[uint32][]int32 // trigram -> indexes into idx.Files
+}
+
+// New creates a searcher for the indexes in dir.
+func New(dir string) *Searcher {
+	return &Searcher{dir: dir, indexes: make(map[string]*loadedIndex), building: make(map[string]*indexBuild)}
+}
+
+// Query is a code search request.
+type Query struct {
+	Pattern string
+	Regex   bool   // Pattern is a regular expression rather than literal text
+	Repo    string // only list files from this repository
+	Lang    string // only list files in this language
+}
+
+// Repo is a repository to search.
+type Repo struct {
+	Name string
+	Git  *git.Repository
+}
+
+// Results holds the files matching a query.
+type Results struct {
+	Files     []FileMatch
+	Truncated bool    // more files matched than are listed or counted
+	Repos     []Facet // matching files per repository, ignoring Query.Repo
+	Langs     []Facet // matching files per language, ignoring Query.Lang
+}
+
+// Facet is a filter value and the number of matching files it selects.
+type Facet struct {
+	Name  string
+	Count int
+}
+
+// FileMatch is a file with lines matching a query.
+type FileMatch struct {
+	Repo    string
+	Branch  string
+	Path    string
+	Lang    string
+	Lines   []Line
+	Matches int // matching lines in the file, including ones not shown
+}
+
+// Line is a matching line or a line of context around one.
+type Line struct {
+	Number int
+	Match  bool
+	Gap    bool // lines were skipped before this one
+	Spans  []Span
+}
+
+// Span is part of a line; Match marks the parts the query matched.
+type Span struct {
+	Text  string
+	Match bool
+}
+
+// ErrInvalidQuery is returned for a pattern that can't be searched for.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Search runs q against repos, updating their indexes first if needed.
+func (s *Searcher) Search(ctx context.Context, repos []Repo, q Query) (*Results, error) {
+	re, required, err := compile(q)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without trigrams every file is a candidate, which is only affordable
+	// in a single repository.
+	if len(required) == 0 && q.Repo == "" {
+		return nil, fmt.Errorf("%w: pattern needs at least 3 characters of literal text, or choose a repository", ErrInvalidQuery)
+	}
+
+	res := &Results{}
+	repoCounts := make(map[string]int)
+	langCounts := make(map[string]int)
+	counted, read := 0, 0
+
+repos:
+	for _, repo := range repos {
+		if len(required) == 0 && repo.Name != q.Repo {
+			continue
+		}
+		li, err := s.load(repo)
+		if err != nil {
+			return nil, err
+		}
+		if li == nil {
+			continue
+		}
+		inRepo := q.Repo == "" || q.Repo == repo.Name
+		for _, i := range li.candidates(required) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			f := &li.idx.Files[i]
+			inLang := q.Lang == "" || q.Lang == f.Lang
+			if !inRepo && !inLang {
+				continue
+			}
+			if counted == maxFacetFiles || read == maxReadFiles {
+				res.Truncated = true
+				break repos
+			}
+
+			read++
+			content, err := readBlob(repo.Git, f.Blob)
+			if err != nil || content == nil {
+				continue
+			}
+			m := matchFile(re, string(content))
+			if m == nil {
+				continue
+			}
+			counted++
+			if inLang {
+				repoCounts[repo.Name]++
+			}
+			if inRepo && f.Lang != "" {
+				langCounts[f.Lang]++
+			}
+			if !inRepo || !inLang {
+				continue
+			}
+			if len(res.Files) == maxFiles {
+				res.Truncated = true
+				continue
+			}
+			m.Repo, m.Branch, m.Path, m.Lang = repo.Name, li.idx.Branch, f.Path, f.Lang
+			res.Files = append(res.Files, *m)
+		}
+	}
+
+	res.Repos = facets(repoCounts)
+	res.Langs = facets(langCounts)
+	return res, nil
+}
+
+// load returns the index of a repository, bringing it up to date with the
+// default branch and reloading it if it changed on disk. It returns nil
+// for an empty repository. Indexes are built without holding s.mu, so
+// searches of other repositories go on meanwhile; concurrent loads of the
+// same repository wait for the one build.
+func (s *Searcher) load(repo Repo) (*loadedIndex, error) {
+	branch := gitpkg.DefaultBranch(repo.Git)
+	commit, err := gitpkg.ResolveCommit(repo.Git, branch)
+	if err != nil {
+		return nil, nil
+	}
+	path := indexPath(s.dir, repo.Name)
+
+	s.mu.Lock()
+	li := s.indexes[repo.Name]
+	if st, err := os.Stat(path); err == nil && li != nil && st.ModTime().Equal(li.modTime) &&
+		li.idx.Branch == branch && li.idx.Commit == commit.Hash.String() {
+		s.mu.Unlock()
+		return li, nil
+	}
+	if b := s.building[repo.Name]; b != nil {
+		s.mu.Unlock()
+		<-b.done
+		return b.li, b.err
+	}
+	b := &indexBuild{done: make(chan struct{})}
+	s.building[repo.Name] = b
+	s.mu.Unlock()
+
+	b.li, b.err = s.build(repo, path)
+
+	s.mu.Lock()
+	delete(s.building, repo.Name)
+	if b.err == nil {
+		if b.li == nil {
+			delete(s.indexes, repo.Name)
+		} else {
+			s.indexes[repo.Name] = b.li
+		}
+	}
+	s.mu.Unlock()
+	close(b.done)
+	return b.li, b.err
+}
+
+// build brings the index of a repository up to date and loads it.
+func (s *Searcher) build(repo Repo, path string) (*loadedIndex, error) {
+	idx, err := update(s.dir, repo.Name, repo.Git)
+	if err != nil {
+		return nil, fmt.Errorf("update index of %s: %w", repo.Name, err)
+	}
+	if idx == nil {
+		return nil, nil
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("update index of %s: %w", repo.Name, err)
+	}
+
+	li := &loadedIndex{modTime: st.ModTime(), idx: idx, postings: make(map[uint32][]int32)}
+	for i, f := range idx.Files {
+		for _, t := range f.Trigrams {
+			li.postings[t] = append(li.postings[t], int32(i))
+		}
+	}
+	return li, nil
+}
+
+// candidates returns the files containing every one of trigrams, in index
+// order; with no trigrams, that is every file.
+func (li *loadedIndex) candidates(trigrams []uint32) []int32 {
+	if len(trigrams) == 0 {
+		all := make([]int32, len(li.idx.Files))
+		for i := range all {
+			all[i] = int32(i)
+		}
+		return all
+	}
+
+	lists := make([][]int32, len(trigrams))
+	for i, t := range trigrams {
+		if lists[i] = li.postings[t]; len(lists[i]) == 0 {
+			return nil
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	result := lists[0]
+	for _, list := range lists[1:] {
+		var next []int32
+		for i, j := 0, 0; i < len(result) && j < len(list); {
+			switch {
+			case result[i] < list[j]:
+				i++
+			case result[i] > list[j]:
+				j++
+			default:
+				next = append(next, result[i])
+				i++
+				j++
+			}
+		}
+		if result = next; len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+// compile turns a query into the regular expression lines are matched
+// with and the trigrams a file must contain to have a match. Literal
+// queries are matched case-insensitively.
+func compile(q Query) (*regexp.Regexp, []uint32, error) {
+	if q.Pattern == "" {
+		return nil, nil, fmt.Errorf("%w: empty pattern", ErrInvalidQuery)
+	}
+	if len(q.Pattern) > maxPatternLen {
+		return nil, nil, fmt.Errorf("%w: pattern longer than %d bytes", ErrInvalidQuery, maxPatternLen)
+	}
+
+	if !q.Regex {
+		re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(q.Pattern))
+		return re, literalTrigrams(q.Pattern, nil), nil
+	}
+
+	re, err := regexp.Compile(q.Pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	parsed, err := syntax.Parse(q.Pattern, syntax.Perl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return re, dedup(requiredTrigrams(parsed.Simplify(), nil)), nil
+}
+
+// requiredTrigrams appends the trigrams of literal text that every match
+// of re must contain: runs of literals in a concatenation, looking inside
+// groups and repetitions that must occur at least once. Alternations and
+// optional parts contribute nothing.
+func requiredTrigrams(re *syntax.Regexp, out []uint32) []uint32 {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literalTrigrams(string(re.Rune), out)
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredTrigrams(re.Sub[0], out)
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredTrigrams(re.Sub[0], out)
+		}
+	case syntax.OpConcat:
+		var run strings.Builder
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				run.WriteString(string(sub.Rune))
+				continue
+			}
+			out = literalTrigrams(run.String(), out)
+			run.Reset()
+			out = requiredTrigrams(sub, out)
+		}
+		return literalTrigrams(run.String(), out)
+	}
+	return out
+}
+
+// literalTrigrams appends the trigrams of s. The index is lower-cased, so
+// they hold for case-insensitive matches too, except for non-ASCII
+// letters; trigrams with non-ASCII bytes are left out.
+func literalTrigrams(s string, out []uint32) []uint32 {
+	for i := 0; i+2 < len(s); i++ {
+		if !indexable(s[i]) || !indexable(s[i+1]) || !indexable(s[i+2]) {
+			continue
+		}
+		out = append(out, trigram(s[i], s[i+1], s[i+2]))
+	}
+	return out
+}
+
+func indexable(b byte) bool {
+	return b != '\n' && b < 0x80
+}
+
+func dedup(ts []uint32) []uint32 {
+	sort.Slice(ts, func(i, j int) bool { return ts[i] < ts[j] })
+	out := ts[:0]
+	for i, t := range ts {
+		if i == 0 || t != ts[i-1] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// matchFile returns the lines of content matching re, each with a line of
+// context on either side, or nil if none match.
+func matchFile(re *regexp.Regexp, content string) *FileMatch {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	m := &FileMatch{}
+	shown := make(map[int][][]int)
+	var order []int
+	for i, line := range lines {
+		locs := re.FindAllStringIndex(line, -1)
+		if len(locs) == 0 {
+			continue
+		}
+		m.Matches++
+		if len(order) < maxLinesPerFile {
+			shown[i] = locs
+			order = append(order, i)
+		}
+	}
+	if m.Matches == 0 {
+		return nil
+	}
+
+	last := -1
+	for _, i := range order {
+		for n := max(i-1, last+1); n <= min(i+1, len(lines)-1); n++ {
+			if _, ok := shown[n]; n != i && ok {
+				continue
+			}
+			m.Lines = append(m.Lines, Line{
+				Number: n + 1,
+				Match:  n == i,
+				Gap:    last >= 0 && n > last+1,
+				Spans:  spans(strings.TrimSuffix(lines[n], "\r"), shown[n], n == i),
+			})
+			last = n
+		}
+	}
+	return m
+}
+
+// spans splits a line at the matched ranges in locs.
+func spans(line string, locs [][]int, match bool) []Span {
+	if !match {
+		return []Span{{Text: line}}
+	}
+	var out []Span
+	pos := 0
+	for _, loc := range locs {
+		start, end := min(loc[0], len(line)), min(loc[1], len(line))
+		if start == end {
+			continue
+		}
+		if start > pos {
+			out = append(out, Span{Text: line[pos:start]})
+		}
+		out = append(out, Span{Text: line[start:end], Match: true})
+		pos = end
+	}
+	if pos < len(line) {
+		out = append(out, Span{Text: line[pos:]})
+	}
+	return out
+}
+
+// facets sorts filter counts, largest first.
+func facets(counts map[string]int) []Facet {
+	out := make([]Facet, 0, len(counts))
+	for name, n := range counts {
+		out = append(out, Facet{Name: name, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// RemoveRepo drops the index of a deleted or renamed repository.
+func (s *Searcher) RemoveRepo(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.indexes, name)
+	return Remove(s.dir, name)
+}
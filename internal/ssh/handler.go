@@ -1,21 +1,28 @@
 package ssh
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log/slog"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/gliderlabs/ssh"
 	gossh "golang.org/x/crypto/ssh"
 
+	"github.com/wbrijesh/origin/internal/db"
 	gitpkg "github.com/wbrijesh/origin/internal/git"
 )
 
 // handleSession handles an incoming SSH session. It parses the git command
-// and executes the appropriate git service (upload-pack or receive-pack).
+// and executes the appropriate git service (upload-pack, receive-pack or
+// upload-archive).
+// Sessions authenticated without a registered key are anonymous: they may
+// only run upload-pack against public repositories.
 func (s *Server) handleSession(sess ssh.Session) {
+	anonymous := !isRegistered(sess.Context())
+
 	cmd := sess.RawCommand()
 	if cmd == "" {
 		fmt.Fprintln(sess.Stderr(), "interactive SSH sessions are not supported")
@@ -23,6 +30,17 @@ func (s *Server) handleSession(sess ssh.Session) {
 		return
 	}
 
+	// Release management is for registered keys only
+	if fields := sess.Command(); len(fields) > 0 && fields[0] == "release" {
+		if anonymous {
+			fmt.Fprintln(sess.Stderr(), "anonymous access is read-only — use a registered SSH key to manage releases")
+			sess.Exit(1) //nolint:errcheck
+			return
+		}
+		s.handleReleaseCommand(sess, fields[1:])
+		return
+	}
+
 	args := strings.Fields(cmd)
 	if len(args) != 2 {
 		fmt.Fprintf(sess.Stderr(), "invalid command: %s\n", cmd)
@@ -33,35 +51,46 @@ func (s *Server) handleSession(sess ssh.Session) {
 	serviceName := args[0]
 	repoName := sanitizeRepoName(args[1])
 
-	// Only allow git-upload-pack and git-receive-pack
+	// Only allow git-upload-pack, git-receive-pack and git-upload-archive
 	var service gitpkg.Service
 	switch serviceName {
 	case "git-upload-pack":
 		service = gitpkg.UploadPackService
 	case "git-receive-pack":
 		service = gitpkg.ReceivePackService
+	case "git-upload-archive":
+		service = gitpkg.UploadArchiveService
 	default:
 		fmt.Fprintf(sess.Stderr(), "unsupported command: %s\n", serviceName)
 		sess.Exit(1) //nolint:errcheck
 		return
 	}
 
-	// Verify repo exists in database
-	var repoID int
-	err := s.db.Get(&repoID, "SELECT id FROM repositories WHERE name = ?", repoName)
-	if err != nil {
+	// Anonymous sessions may only clone and fetch.
+	if anonymous && service != gitpkg.UploadPackService {
+		fmt.Fprintln(sess.Stderr(), "anonymous access is limited to fetching — use a registered SSH key")
+		sess.Exit(1) //nolint:errcheck
+		return
+	}
+
+	// Verify repo exists in database; anonymous sessions can't see private repos
+	if !db.CanReadRepo(s.db, repoName, !anonymous) {
 		fmt.Fprintf(sess.Stderr(), "repository not found: %s\n", repoName)
 		sess.Exit(1) //nolint:errcheck
 		return
 	}
 
 	repoPath := filepath.Join(s.cfg.ReposPath(), repoName+".git")
-	fp := gossh.FingerprintSHA256(sess.PublicKey())
+	fp := ""
+	if !anonymous {
+		fp = gossh.FingerprintSHA256(sess.PublicKey())
+	}
 
 	slog.Info("SSH git",
 		"service", serviceName,
 		"repo", repoName,
 		"fingerprint", fp,
+		"anonymous", anonymous,
 		"remote", sess.RemoteAddr(),
 	)
 
@@ -73,24 +102,56 @@ func (s *Server) handleSession(sess ssh.Session) {
 		"ORIGIN_DATA_PATH=" + s.cfg.DataPath,
 	}
 
-	// Execute git command
-	gitCmd := exec.CommandContext(sess.Context(), "git", service.String()[4:], repoPath) // strip "git-" prefix
-	gitCmd.Dir = repoPath
-	gitCmd.Env = append(gitCmd.Environ(), env...)
-	gitCmd.Stdin = sess
-	gitCmd.Stdout = sess
-	gitCmd.Stderr = sess.Stderr()
+	// Watch upload-pack requests so partial and shallow clones show up
+	// in the admin stats.
+	var stdin io.Reader = sess
+	var fetch *gitpkg.FetchRequest
+	switch service {
+	case gitpkg.UploadPackService:
+		stdin, fetch = gitpkg.InspectFetch(sess)
+	case gitpkg.UploadArchiveService:
+		// Check the requested format against the server's archive settings
+		// before handing the request to upload-archive.
+		args, raw, err := gitpkg.ReadArchiveArguments(sess)
+		if err != nil {
+			fmt.Fprintf(sess.Stderr(), "invalid archive request: %v\n", err)
+			sess.Exit(1) //nolint:errcheck
+			return
+		}
+		if format := gitpkg.ArchiveFormat(args); !s.cfg.ArchiveFormatAllowed(format) {
+			gitpkg.WritePktline(sess, "NACK archive format not allowed: "+format) //nolint:errcheck
+			sess.Exit(1)                                                          //nolint:errcheck
+			return
+		}
+		stdin = io.MultiReader(bytes.NewReader(raw), sess)
+	}
 
-	if err := gitCmd.Run(); err != nil {
+	// Execute git command, forwarding the client's protocol request
+	// (e.g. GIT_PROTOCOL=version=2) so v2 can be negotiated.
+	cmdErr := service.Run(sess.Context(), gitpkg.ServiceCommand{
+		Dir:      repoPath,
+		Env:      env,
+		Protocol: gitpkg.SanitizeProtocol(sessionEnv(sess, "GIT_PROTOCOL")),
+		Stdin:    stdin,
+		Stdout:   sess,
+		Stderr:   sess.Stderr(),
+	})
+	if cmdErr != nil {
 		slog.Error("SSH git command failed",
 			"service", serviceName,
 			"repo", repoName,
-			"error", err,
+			"error", cmdErr,
 		)
 		sess.Exit(1) //nolint:errcheck
 		return
 	}
 
+	if fetch != nil && fetch.Wants > 0 {
+		if err := db.RecordFetch(s.db, repoName, fetch.Filter, fetch.Shallow); err != nil {
+			slog.Error("record fetch", "repo", repoName, "error", err)
+		}
+	}
+
 	sess.Exit(0) //nolint:errcheck
 }
 
@@ -103,3 +164,15 @@ func sanitizeRepoName(name string) string {
 	name = strings.TrimSuffix(name, ".git")
 	return filepath.Clean(name)
 }
+
+// sessionEnv returns the value of an environment variable the client sent
+// with the session (via SendEnv/SetEnv), or "" if it was not sent.
+func sessionEnv(sess ssh.Session, key string) string {
+	prefix := key + "="
+	for _, kv := range sess.Environ() {
+		if strings.HasPrefix(kv, prefix) {
+			return strings.TrimPrefix(kv, prefix)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package ssh
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/gliderlabs/ssh"
+
+	"github.com/wbrijesh/origin/internal/release"
+)
+
+const releaseUsage = `usage:
+  release list <repo>
+  release create [-title T] [-notes N] [-draft] [-prerelease] <repo> <tag>
+  release publish <repo> <tag>
+  release upload <repo> <tag> <name> < file
+  release delete-asset <repo> <tag> <name>
+  release delete <repo> <tag>
+`
+
+// handleReleaseCommand runs a "release ..." management command, letting CI
+// publish releases with its deploy key:
+//
+//	ssh origin.example.com release create -title "v1.2.0" tool v1.2.0
+//	ssh origin.example.com release upload tool v1.2.0 tool_linux_amd64.tar.gz < dist/tool_linux_amd64.tar.gz
+func (s *Server) handleReleaseCommand(sess ssh.Session, args []string) {
+	if len(args) == 0 {
+		s.releaseFail(sess, errors.New(releaseUsage))
+		return
+	}
+
+	store := release.New(s.cfg, s.db)
+	out := sess
+	sub, args := args[0], args[1:]
+
+	// repoTag checks the positional <repo> <tag> arguments and that the
+	// repo exists; any remaining arguments are returned.
+	repoTag := func(n int) (string, string, []string, bool) {
+		if len(args) != n {
+			s.releaseFail(sess, errors.New(releaseUsage))
+			return "", "", nil, false
+		}
+		repoName := sanitizeRepoName(args[0])
+		var count int
+		if err := s.db.Get(&count, "SELECT COUNT(*) FROM repositories WHERE name = ?", repoName); err != nil || count == 0 {
+			s.releaseFail(sess, fmt.Errorf("repository not found: %s", repoName))
+			return "", "", nil, false
+		}
+		return repoName, args[1], args[2:], true
+	}
+
+	switch sub {
+	case "list":
+		if len(args) != 1 {
+			s.releaseFail(sess, errors.New(releaseUsage))
+			return
+		}
+		releases, err := store.List(sanitizeRepoName(args[0]), true)
+		if err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, rel := range releases {
+			state := "published"
+			switch {
+			case rel.IsDraft:
+				state = "draft"
+			case rel.IsPrerelease:
+				state = "pre-release"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d assets\n", rel.Tag, state, rel.DisplayTitle(), len(rel.Assets))
+		}
+		tw.Flush() //nolint:errcheck
+
+	case "create":
+		fs := flag.NewFlagSet("release create", flag.ContinueOnError)
+		fs.SetOutput(sess.Stderr())
+		title := fs.String("title", "", "release title")
+		notes := fs.String("notes", "", "release notes (markdown)")
+		draft := fs.Bool("draft", false, "create as a draft")
+		prerelease := fs.Bool("prerelease", false, "mark as a pre-release")
+		if err := fs.Parse(args); err != nil {
+			sess.Exit(1) //nolint:errcheck
+			return
+		}
+		args = fs.Args()
+		repoName, tag, _, ok := repoTag(2)
+		if !ok {
+			return
+		}
+		rel := &release.Release{Tag: tag, Title: *title, Notes: *notes, IsDraft: *draft, IsPrerelease: *prerelease}
+		if err := store.Create(repoName, rel); err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		fmt.Fprintf(out, "created release %s\n", tag)
+
+	case "publish":
+		repoName, tag, _, ok := repoTag(2)
+		if !ok {
+			return
+		}
+		rel, err := store.Get(repoName, tag)
+		if err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		rel.IsDraft = false
+		if err := store.Update(rel); err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		fmt.Fprintf(out, "published release %s\n", tag)
+
+	case "upload":
+		repoName, tag, rest, ok := repoTag(3)
+		if !ok {
+			return
+		}
+		rel, err := store.Get(repoName, tag)
+		if err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		asset, err := store.AddAsset(rel, rest[0], "", sess, s.cfg.Releases.MaxAssetMB<<20)
+		if err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		fmt.Fprintf(out, "uploaded %s (%d bytes, sha256 %s)\n", asset.Name, asset.Size, asset.SHA256)
+
+	case "delete-asset":
+		repoName, tag, rest, ok := repoTag(3)
+		if !ok {
+			return
+		}
+		rel, err := store.Get(repoName, tag)
+		if err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		asset, err := rel.FindAsset(rest[0])
+		if err == nil {
+			err = store.DeleteAsset(asset)
+		}
+		if err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		fmt.Fprintf(out, "deleted asset %s\n", rest[0])
+
+	case "delete":
+		repoName, tag, _, ok := repoTag(2)
+		if !ok {
+			return
+		}
+		rel, err := store.Get(repoName, tag)
+		if err == nil {
+			err = store.Delete(rel)
+		}
+		if err != nil {
+			s.releaseFail(sess, err)
+			return
+		}
+		fmt.Fprintf(out, "deleted release %s\n", tag)
+
+	default:
+		s.releaseFail(sess, errors.New(releaseUsage))
+		return
+	}
+
+	sess.Exit(0) //nolint:errcheck
+}
+
+// releaseFail reports a failed release command to the client.
+func (s *Server) releaseFail(sess ssh.Session, err error) {
+	io.WriteString(sess.Stderr(), "release: "+err.Error()+"\n") //nolint:errcheck
+	sess.Exit(1)                                                //nolint:errcheck
+}
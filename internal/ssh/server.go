@@ -40,6 +40,9 @@ func New(cfg *config.Config, db *sqlx.DB) (*Server, error) {
 		Handler:          s.handleSession,
 		PublicKeyHandler: s.publicKeyHandler,
 	}
+	if cfg.SSH.AllowAnonymous {
+		s.server.KeyboardInteractiveHandler = s.keyboardInteractiveHandler
+	}
 
 	s.server.AddHostKey(hostKey)
 
@@ -106,23 +109,67 @@ func (s *Server) ensureHostKey() (gossh.Signer, error) {
 	return signer, nil
 }
 
+// registeredKey is the context key under which the auth handlers record
+// whether the connection authenticated with a registered key. Clients can
+// offer keys they don't hold, so the key in the context alone proves
+// nothing; handleSession goes by this record instead.
+var registeredKey = &contextKey{"registered-key"}
+
+type contextKey struct{ name string }
+
+// isRegistered reports whether the connection of ctx authenticated with a
+// registered key.
+func isRegistered(ctx ssh.Context) bool {
+	registered, _ := ctx.Value(registeredKey).(bool)
+	return registered
+}
+
 // publicKeyHandler verifies that the connecting user's public key
-// is registered in the database.
+// is registered in the database. With anonymous access enabled, unknown
+// keys are accepted too; handleSession then treats them as anonymous.
+// The key is checked again when the client proves it holds it, unless it
+// was the last key checked, so the recorded result is always that of the
+// key the client authenticates with.
 func (s *Server) publicKeyHandler(ctx ssh.Context, key ssh.PublicKey) bool {
 	fp := gossh.FingerprintSHA256(key)
 
-	var count int
-	err := s.db.Get(&count, "SELECT COUNT(*) FROM ssh_keys WHERE fingerprint = ?", fp)
-	if err != nil {
-		slog.Error("SSH auth: database error", "error", err)
-		return false
+	registered := s.isRegisteredKey(key)
+	ctx.SetValue(registeredKey, registered)
+	if registered {
+		slog.Debug("SSH auth: accepted", "fingerprint", fp, "remote", ctx.RemoteAddr())
+		return true
 	}
 
-	if count == 0 {
-		slog.Warn("SSH auth: unknown key", "fingerprint", fp, "remote", ctx.RemoteAddr())
-		return false
+	if s.cfg.SSH.AllowAnonymous {
+		slog.Debug("SSH auth: accepted as anonymous", "fingerprint", fp, "remote", ctx.RemoteAddr())
+		return true
 	}
 
-	slog.Debug("SSH auth: accepted", "fingerprint", fp, "remote", ctx.RemoteAddr())
+	slog.Warn("SSH auth: unknown key", "fingerprint", fp, "remote", ctx.RemoteAddr())
+	return false
+}
+
+// keyboardInteractiveHandler lets clients without any key in. It is only
+// installed when anonymous access is enabled, and asks no questions. A key
+// offered earlier on the connection, but never proven, is forgotten.
+func (s *Server) keyboardInteractiveHandler(ctx ssh.Context, _ gossh.KeyboardInteractiveChallenge) bool {
+	ctx.SetValue(registeredKey, false)
+	ctx.SetValue(ssh.ContextKeyPublicKey, nil)
+	slog.Debug("SSH auth: anonymous keyboard-interactive", "remote", ctx.RemoteAddr())
 	return true
 }
+
+// isRegisteredKey reports whether key is one of the registered SSH keys.
+func (s *Server) isRegisteredKey(key ssh.PublicKey) bool {
+	if key == nil {
+		return false
+	}
+
+	var count int
+	err := s.db.Get(&count, "SELECT COUNT(*) FROM ssh_keys WHERE fingerprint = ?", gossh.FingerprintSHA256(key))
+	if err != nil {
+		slog.Error("SSH auth: database error", "error", err)
+		return false
+	}
+	return count > 0
+}
@@ -0,0 +1,318 @@
+// Package stats computes a repository's statistics and keeps them in the
+// database: the languages of its default branch by bytes, its top
+// contributors, how many commits were made each day over the last year,
+// and its size on disk.
+//
+// The post-receive hook recomputes them after every push; a repository
+// that hasn't been pushed to since is brought up to date when its stats
+// are read.
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/jmoiron/sqlx"
+
+	gitpkg "github.com/wbrijesh/origin/internal/git"
+	"github.com/wbrijesh/origin/internal/lang"
+)
+
+// maxContributors is how many of the top contributors are kept.
+const maxContributors = 100
+
+// activityDays is how far back commits are counted by day.
+const activityDays = 371 // 53 weeks
+
+// Store reads and updates repository stats.
+type Store struct {
+	db *sqlx.DB
+}
+
+// New creates a store backed by db.
+func New(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+// Stats are a repository's statistics as of a commit of its default
+// branch.
+type Stats struct {
+	Commit       string    `db:"commit_hash"`
+	Files        int       `db:"files"`
+	Size         int64     `db:"size"` // bytes on disk
+	Commits      int       `db:"commits"`
+	ComputedAt   time.Time `db:"computed_at"`
+	Languages    []Language
+	Contributors []gitpkg.Contributor
+	Activity     map[string]int // commits by day, as YYYY-MM-DD
+}
+
+// Language is a language's share of the files of the default branch.
+type Language struct {
+	Name    string  `db:"language"`
+	Bytes   int64   `db:"bytes"`
+	Files   int     `db:"files"`
+	Percent float64 `db:"-"`
+	Color   string  `db:"-"`
+}
+
+// Update recomputes the stats of a repository. It does nothing for a
+// repository without commits.
+func (s *Store) Update(ctx context.Context, repoName, repoPath string) error {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", repoName, err)
+	}
+	commit, err := gitpkg.ResolveCommit(repo, gitpkg.DefaultBranch(repo))
+	if err != nil {
+		return nil
+	}
+	var repoID int64
+	if err := s.db.Get(&repoID, "SELECT id FROM repositories WHERE name = ?", repoName); err != nil {
+		return fmt.Errorf("find repository %s: %w", repoName, err)
+	}
+
+	files, err := gitpkg.FileSizes(ctx, repoPath, commit.Hash)
+	if err != nil {
+		return err
+	}
+	languages := make(map[string]*Language)
+	for _, f := range files {
+		name := lang.Detect(f.Path)
+		if name == "" {
+			continue
+		}
+		l := languages[name]
+		if l == nil {
+			l = &Language{Name: name}
+			languages[name] = l
+		}
+		l.Bytes += f.Size
+		l.Files++
+	}
+
+	contributors, err := gitpkg.Contributors(ctx, repoPath, commit.Hash)
+	if err != nil {
+		return err
+	}
+	commits := 0
+	for _, c := range contributors {
+		commits += c.Commits
+	}
+	if len(contributors) > maxContributors {
+		contributors = contributors[:maxContributors]
+	}
+
+	since := time.Now().AddDate(0, 0, -activityDays)
+	activity, err := gitpkg.CommitDays(ctx, repoPath, commit.Hash, since)
+	if err != nil {
+		return err
+	}
+
+	size, err := dirSize(repoPath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("save stats: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, table := range []string{"repo_languages", "repo_contributors", "repo_activity"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE repo_id = ?", repoID); err != nil {
+			return fmt.Errorf("save stats: %w", err)
+		}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO repo_stats (repo_id, commit_hash, files, size, commits, computed_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(repo_id) DO UPDATE SET
+			commit_hash = excluded.commit_hash,
+			files       = excluded.files,
+			size        = excluded.size,
+			commits     = excluded.commits,
+			computed_at = excluded.computed_at`,
+		repoID, commit.Hash.String(), len(files), size, commits,
+	)
+	if err != nil {
+		return fmt.Errorf("save stats: %w", err)
+	}
+	for _, l := range languages {
+		if _, err := tx.Exec("INSERT INTO repo_languages (repo_id, language, bytes, files) VALUES (?, ?, ?, ?)",
+			repoID, l.Name, l.Bytes, l.Files); err != nil {
+			return fmt.Errorf("save stats: %w", err)
+		}
+	}
+	for i, c := range contributors {
+		if _, err := tx.Exec("INSERT INTO repo_contributors (repo_id, rank, name, email, commits) VALUES (?, ?, ?, ?, ?)",
+			repoID, i, c.Name, c.Email, c.Commits); err != nil {
+			return fmt.Errorf("save stats: %w", err)
+		}
+	}
+	for day, n := range activity {
+		if _, err := tx.Exec("INSERT INTO repo_activity (repo_id, day, commits) VALUES (?, ?, ?)",
+			repoID, day, n); err != nil {
+			return fmt.Errorf("save stats: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save stats: %w", err)
+	}
+	return nil
+}
+
+// Get returns the stats of a repository, updating them first if they
+// were never computed or its default branch has moved since. It returns
+// nil for a repository without commits.
+func (s *Store) Get(ctx context.Context, repoName, repoPath string) (*Stats, error) {
+	st, err := s.load(repoName)
+	if err != nil {
+		return nil, err
+	}
+	if repo, err := git.PlainOpen(repoPath); err == nil {
+		if commit, err := gitpkg.ResolveCommit(repo, gitpkg.DefaultBranch(repo)); err == nil &&
+			(st == nil || st.Commit != commit.Hash.String()) {
+			if err := s.Update(ctx, repoName, repoPath); err != nil {
+				return nil, err
+			}
+			return s.load(repoName)
+		}
+	}
+	return st, nil
+}
+
+func (s *Store) load(repoName string) (*Stats, error) {
+	var st Stats
+	err := s.db.Get(&st, `
+		SELECT s.commit_hash, s.files, s.size, s.commits, s.computed_at
+		FROM repo_stats s JOIN repositories r ON s.repo_id = r.id
+		WHERE r.name = ?`, repoName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load stats: %w", err)
+	}
+
+	err = s.db.Select(&st.Languages, `
+		SELECT l.language, l.bytes, l.files FROM repo_languages l JOIN repositories r ON l.repo_id = r.id
+		WHERE r.name = ? ORDER BY l.bytes DESC, l.language`, repoName)
+	if err != nil {
+		return nil, fmt.Errorf("load languages: %w", err)
+	}
+	var total int64
+	for _, l := range st.Languages {
+		total += l.Bytes
+	}
+	for i := range st.Languages {
+		l := &st.Languages[i]
+		if total > 0 {
+			l.Percent = float64(l.Bytes) * 100 / float64(total)
+		}
+		l.Color = lang.Color(l.Name)
+	}
+
+	var contributors []struct {
+		Name    string `db:"name"`
+		Email   string `db:"email"`
+		Commits int    `db:"commits"`
+	}
+	err = s.db.Select(&contributors, `
+		SELECT c.name, c.email, c.commits FROM repo_contributors c JOIN repositories r ON c.repo_id = r.id
+		WHERE r.name = ? ORDER BY c.rank`, repoName)
+	if err != nil {
+		return nil, fmt.Errorf("load contributors: %w", err)
+	}
+	for _, c := range contributors {
+		st.Contributors = append(st.Contributors, gitpkg.Contributor(c))
+	}
+
+	var days []struct {
+		Day     string `db:"day"`
+		Commits int    `db:"commits"`
+	}
+	err = s.db.Select(&days, `
+		SELECT a.day, a.commits FROM repo_activity a JOIN repositories r ON a.repo_id = r.id
+		WHERE r.name = ?`, repoName)
+	if err != nil {
+		return nil, fmt.Errorf("load activity: %w", err)
+	}
+	st.Activity = make(map[string]int, len(days))
+	for _, d := range days {
+		st.Activity[d.Day] = d.Commits
+	}
+	return &st, nil
+}
+
+// Day is a day of the activity calendar.
+type Day struct {
+	Date    time.Time
+	Commits int
+	Level   int  // 0 for no commits, up to 4 for the busiest days
+	Future  bool // after the calendar's last day, in its last week
+}
+
+// Calendar lays out the activity of the 53 weeks up to end as weeks of
+// seven days, Sunday first.
+func (st *Stats) Calendar(end time.Time) [][7]Day {
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, 0, -int(end.Weekday())-52*7)
+
+	busiest := 0
+	for _, n := range st.Activity {
+		busiest = max(busiest, n)
+	}
+
+	var weeks [][7]Day
+	for d := start; !d.After(end) || d.Weekday() != time.Sunday; d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == time.Sunday {
+			weeks = append(weeks, [7]Day{})
+		}
+		day := Day{Date: d, Future: d.After(end)}
+		if !day.Future {
+			day.Commits = st.Activity[d.Format("2006-01-02")]
+		}
+		if day.Commits > 0 {
+			day.Level = (day.Commits*4 + busiest - 1) / busiest
+		}
+		weeks[len(weeks)-1][d.Weekday()] = day
+	}
+	return weeks
+}
+
+// dirSize returns the total size of the files under dir. Files removed
+// while it runs, as by git gc, are skipped.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("repository size: %w", err)
+	}
+	return size, nil
+}
@@ -7,10 +7,15 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
+	"github.com/jmoiron/sqlx"
+
 	"github.com/wbrijesh/origin/internal/config"
+	"github.com/wbrijesh/origin/internal/daemon"
 	"github.com/wbrijesh/origin/internal/db"
+	gitpkg "github.com/wbrijesh/origin/internal/git"
 	"github.com/wbrijesh/origin/internal/hooks"
 	httpsrv "github.com/wbrijesh/origin/internal/http"
 	sshsrv "github.com/wbrijesh/origin/internal/ssh"
@@ -61,6 +66,10 @@ func main() {
 
 	slog.Info("database ready", "path", cfg.DBPath())
 
+	// Repositories created before Origin managed upload-pack capabilities
+	// get the ones new repositories start with.
+	ensureUploadPackConfig(cfg, database)
+
 	// Set up graceful shutdown
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
@@ -75,10 +84,16 @@ func main() {
 	// Create HTTP server
 	httpServer := httpsrv.New(cfg, database)
 
+	// Create git:// daemon (optional)
+	var gitDaemon *daemon.Server
+	if cfg.GitDaemon.Enabled {
+		gitDaemon = daemon.New(cfg, database)
+	}
+
 	slog.Info(fmt.Sprintf("%s is ready", cfg.Name))
 
 	// Start servers concurrently.
-	// Each server runs independently — if one fails, the other keeps going.
+	// Each server runs independently — if one fails, the others keep going.
 	go func() {
 		if err := sshServer.ListenAndServe(); err != nil {
 			slog.Error("SSH server failed", "error", err)
@@ -91,11 +106,38 @@ func main() {
 		}
 	}()
 
+	if gitDaemon != nil {
+		go func() {
+			if err := gitDaemon.ListenAndServe(); err != nil {
+				slog.Error("git daemon failed", "error", err)
+			}
+		}()
+	}
+
 	// Wait for shutdown signal
 	<-ctx.Done()
 	slog.Info("shutting down...")
 	sshServer.Close()
 	httpServer.Close()
+	if gitDaemon != nil {
+		gitDaemon.Close()
+	}
+}
+
+// ensureUploadPackConfig applies the default upload-pack capabilities to
+// every repository that has none configured.
+func ensureUploadPackConfig(cfg *config.Config, database *sqlx.DB) {
+	var names []string
+	if err := database.Select(&names, "SELECT name FROM repositories"); err != nil {
+		slog.Error("failed to list repositories", "error", err)
+		return
+	}
+	for _, name := range names {
+		repoPath := filepath.Join(cfg.ReposPath(), name+".git")
+		if err := gitpkg.EnsureUploadPackConfig(repoPath); err != nil {
+			slog.Error("configure upload-pack failed", "repo", name, "error", err)
+		}
+	}
 }
 
 // runHook executes a git hook. Called by the hook scripts that